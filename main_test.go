@@ -21,3 +21,18 @@ func Test_RootRun(t *testing.T) {
 
 	assert.Equal(t, "unsupported protocol \"ftp\". http and https are supported\n", buf.String())
 }
+
+func Test_AgentRun(t *testing.T) {
+	var buf bytes.Buffer
+	agentCmd.SetOut(&buf)
+	agentCmd.SetErr(&buf)
+
+	agentListen = "invalid"
+	agentRun(agentCmd, nil)
+	assert.Equal(t, "missing agent token\n", buf.String())
+
+	buf.Reset()
+	agentToken = "secret"
+	agentRun(agentCmd, nil)
+	assert.Contains(t, buf.String(), "invalid")
+}
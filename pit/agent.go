@@ -0,0 +1,800 @@
+package pit
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	agentPathPrepare = "/prepare"
+	agentPathStart   = "/start"
+	agentPathStats   = "/stats"
+	agentPathStop    = "/stop"
+)
+
+var (
+	errAgentNotPrepared  = errors.New("agent is not prepared")
+	errMissingAgentToken = errors.New("missing agent token")
+)
+
+// Agent runs benchmarks on behalf of a coordinator, which ships Config
+// and files it needs to it, starts it and collects interval statistics
+// from it. Every request of coordinators must carry the shared token.
+type Agent struct {
+	mut   sync.Mutex
+	run   *agentRun
+	s     *fasthttp.Server
+	token []byte
+}
+
+// NewAgent creates an Agent which serves coordinators with the token
+func NewAgent(token string) *Agent {
+	a := &Agent{token: []byte(token)}
+	a.s = &fasthttp.Server{
+		Name:    "httpit/" + Version,
+		Handler: a.handler,
+		Logger:  discardLogger{},
+	}
+	return a
+}
+
+// ListenAndServe serves coordinators on the tcp address
+func (a *Agent) ListenAndServe(addr string) error {
+	if len(a.token) == 0 {
+		return errMissingAgentToken
+	}
+	return a.s.ListenAndServe(addr)
+}
+
+// ListenAndServeTLS serves coordinators on the tcp address over tls
+func (a *Agent) ListenAndServeTLS(addr, certFile, keyFile string) error {
+	if len(a.token) == 0 {
+		return errMissingAgentToken
+	}
+	return a.s.ListenAndServeTLS(addr, certFile, keyFile)
+}
+
+// Serve serves coordinators on the listener
+func (a *Agent) Serve(ln net.Listener) error {
+	if len(a.token) == 0 {
+		return errMissingAgentToken
+	}
+	return a.s.Serve(ln)
+}
+
+// Shutdown stops the agent and the running benchmark
+func (a *Agent) Shutdown() error {
+	a.mut.Lock()
+	if a.run != nil {
+		a.run.p.stop()
+	}
+	a.mut.Unlock()
+
+	return a.s.Shutdown()
+}
+
+func (a *Agent) handler(ctx *fasthttp.RequestCtx) {
+	if !a.authorized(ctx.Request.Header.Peek(headerAuthorization)) {
+		ctx.Error("unauthorized", fasthttp.StatusUnauthorized)
+		return
+	}
+
+	var err error
+	switch string(ctx.Path()) {
+	case agentPathPrepare:
+		err = a.prepare(ctx.PostBody())
+	case agentPathStart:
+		err = a.start()
+	case agentPathStats:
+		var s *agentStats
+		if s, err = a.stats(); err == nil {
+			var b []byte
+			if b, err = json.Marshal(s); err == nil {
+				ctx.SetContentType(MIMEApplicationJSON)
+				ctx.SetBody(b)
+			}
+		}
+	case agentPathStop:
+		err = a.stop()
+	default:
+		ctx.NotFound()
+		return
+	}
+
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+	}
+}
+
+// authorized reports whether authorization carries the token
+func (a *Agent) authorized(authorization []byte) bool {
+	token := bytes.TrimPrefix(authorization, []byte("Bearer "))
+	return len(a.token) > 0 && len(token) < len(authorization) &&
+		subtle.ConstantTimeCompare(token, a.token) == 1
+}
+
+// agentConfig is Config shipped to agents with contents of files
+// it needs, agents never read their own files
+type agentConfig struct {
+	Config Config            `json:"config"`
+	Files  map[string][]byte `json:"files,omitempty"`
+}
+
+func (a *Agent) prepare(body []byte) (err error) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	if a.run != nil && !a.run.finished() {
+		return errors.New("agent is busy")
+	}
+
+	var ac agentConfig
+	if err = json.Unmarshal(body, &ac); err != nil {
+		return
+	}
+
+	p := New(ac.Config)
+	p.c.fs = &fileSystem{shipped: ac.Files}
+	if err = p.init(); err != nil {
+		return
+	}
+
+	a.run = &agentRun{p: p, exited: make(chan struct{})}
+
+	return
+}
+
+func (a *Agent) start() error {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	if a.run == nil || a.run.started {
+		return errAgentNotPrepared
+	}
+
+	a.run.started = true
+	go func(r *agentRun) {
+		r.p.run()
+		close(r.exited)
+	}(a.run)
+
+	return nil
+}
+
+func (a *Agent) stats() (*agentStats, error) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	if a.run == nil {
+		return nil, errAgentNotPrepared
+	}
+
+	return a.run.collect(), nil
+}
+
+func (a *Agent) stop() error {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	if a.run == nil {
+		return errAgentNotPrepared
+	}
+
+	a.run.p.stop()
+
+	return nil
+}
+
+// agentRun is a benchmark running on agent
+type agentRun struct {
+	p       *Pit
+	started bool
+	exited  chan struct{}
+
+	// collected values of last interval
+	reqs       int64
+	codes      [6]int64
+	latencies  int
+	errs       map[string]int
+	throughput int64
+}
+
+func (r *agentRun) finished() bool {
+	if !r.started {
+		return true
+	}
+
+	select {
+	case <-r.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// agentStats is statistics of an interval reported by agent, counters,
+// groups, metrics and compressions are cumulative values
+type agentStats struct {
+	Reqs         int64                                      `json:"reqs"`
+	Codes        [6]int64                                   `json:"codes"`
+	Latencies    map[int64]int64                            `json:"latencies,omitempty"`
+	Errors       map[string]int                             `json:"errors,omitempty"`
+	Throughput   int64                                      `json:"throughput"`
+	Counters     map[string]map[string]int64                `json:"counters,omitempty"`
+	Groups       map[string]map[string]agentGroupStat       `json:"groups,omitempty"`
+	Metrics      map[string]map[string]agentMetricStat      `json:"metrics,omitempty"`
+	Compressions map[string]map[string]agentCompressionStat `json:"compressions,omitempty"`
+	Done         bool                                       `json:"done"`
+}
+
+type agentGroupStat struct {
+	Unit       string        `json:"unit"`
+	Reqs       int64         `json:"reqs"`
+	Errs       int64         `json:"errs"`
+	LatencySum time.Duration `json:"latencySum"`
+	LatencyMax time.Duration `json:"latencyMax"`
+}
+
+type agentMetricStat struct {
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+type agentCompressionStat struct {
+	Count   int64 `json:"count"`
+	Wire    int64 `json:"wire"`
+	Decoded int64 `json:"decoded"`
+	Failed  int64 `json:"failed"`
+}
+
+// collect collects statistics since last collection
+func (r *agentRun) collect() *agentStats {
+	p := r.p
+	s := &agentStats{Latencies: make(map[int64]int64)}
+
+	p.mut.Lock()
+	s.Done = p.done && r.finished()
+	reqs := atomic.LoadInt64(&p.reqs)
+	s.Reqs, r.reqs = reqs-r.reqs, reqs
+	codes := [6]int64{
+		atomic.LoadInt64(&p.code1xx), atomic.LoadInt64(&p.code2xx), atomic.LoadInt64(&p.code3xx),
+		atomic.LoadInt64(&p.code4xx), atomic.LoadInt64(&p.code5xx), atomic.LoadInt64(&p.codeOthers),
+	}
+	for i := range codes {
+		s.Codes[i] = codes[i] - r.codes[i]
+	}
+	r.codes = codes
+	for _, latency := range p.latencies[r.latencies:] {
+		s.Latencies[roundLatency(latency)]++
+	}
+	r.latencies = len(p.latencies)
+	p.mut.Unlock()
+
+	p.tui.mut.Lock()
+	s.Errors = make(map[string]int)
+	for err, count := range p.errs {
+		if n := count - r.errs[err]; n > 0 {
+			s.Errors[err] = n
+		}
+	}
+	r.errs = make(map[string]int, len(p.errs))
+	for err, count := range p.errs {
+		r.errs[err] = count
+	}
+	p.tui.mut.Unlock()
+
+	throughput := atomic.LoadInt64(&p.c.throughput)
+	s.Throughput, r.throughput = throughput-r.throughput, throughput
+
+	for _, sec := range p.c.sections {
+		switch sec := sec.(type) {
+		case *counter:
+			if s.Counters == nil {
+				s.Counters = make(map[string]map[string]int64)
+			}
+			hits := make(map[string]int64)
+			sec.each(func(key string, n int64) { hits[key] = n })
+			s.Counters[sec.name] = hits
+		case *group:
+			if s.Groups == nil {
+				s.Groups = make(map[string]map[string]agentGroupStat)
+			}
+			stats := make(map[string]agentGroupStat)
+			sec.each(func(key string, gs groupStat) {
+				stats[key] = agentGroupStat{sec.unit, gs.reqs, gs.errs, gs.latencySum, gs.latencyMax}
+			})
+			s.Groups[sec.name] = stats
+		case *metrics:
+			if s.Metrics == nil {
+				s.Metrics = make(map[string]map[string]agentMetricStat)
+			}
+			stats := make(map[string]agentMetricStat)
+			sec.each(func(key string, ms metricStat) {
+				stats[key] = agentMetricStat{ms.count, ms.sum, ms.min, ms.max}
+			})
+			s.Metrics[sec.name] = stats
+		case *compression:
+			if s.Compressions == nil {
+				s.Compressions = make(map[string]map[string]agentCompressionStat)
+			}
+			stats := make(map[string]agentCompressionStat)
+			sec.each(func(encoding string, cs compressionStat) {
+				stats[encoding] = agentCompressionStat{cs.count, cs.wire, cs.decoded, cs.failed}
+			})
+			s.Compressions[sec.name] = stats
+		}
+	}
+
+	return s
+}
+
+// roundLatency rounds latency in microseconds to 3 significant
+// digits, so that latencies are shipped as a small histogram
+func roundLatency(us int64) int64 {
+	var p int64 = 1
+	for us/p >= 1000 {
+		p *= 10
+	}
+	return us / p * p
+}
+
+// coordinator ships Config to agents, starts them together, and merges
+// their interval statistics into Pit
+type coordinator struct {
+	p        *Pit
+	agents   []string
+	client   *fasthttp.Client
+	token    string
+	timeout  time.Duration
+	sections *agentSections
+	// latest cumulative counters, groups, metrics and compressions of every agent
+	counters     []map[string]map[string]int64
+	groups       []map[string]map[string]agentGroupStat
+	metrics      []map[string]map[string]agentMetricStat
+	compressions []map[string]map[string]agentCompressionStat
+	done         []bool
+}
+
+func newCoordinator(p *Pit) (*coordinator, error) {
+	if p.c.AgentToken == "" {
+		return nil, errMissingAgentToken
+	}
+
+	client := &fasthttp.Client{Name: "httpit/" + Version}
+	if p.c.AgentCaCert != "" {
+		pool, err := readCertPool(nil, p.c.AgentCaCert)
+		if err != nil {
+			return nil, err
+		}
+		client.TLSConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	n := len(p.c.Agents)
+	co := &coordinator{
+		p:       p,
+		agents:  p.c.Agents,
+		client:  client,
+		token:   p.c.AgentToken,
+		timeout: p.c.Timeout,
+		sections: &agentSections{
+			counters:     make(map[string]*counter),
+			groups:       make(map[string]*group),
+			metrics:      make(map[string]*metrics),
+			compressions: make(map[string]*compression),
+		},
+		counters:     make([]map[string]map[string]int64, n),
+		groups:       make([]map[string]map[string]agentGroupStat, n),
+		metrics:      make([]map[string]map[string]agentMetricStat, n),
+		compressions: make([]map[string]map[string]agentCompressionStat, n),
+		done:         make([]bool, n),
+	}
+	p.c.addSection(co.sections)
+
+	return co, nil
+}
+
+// prepare ships Config and files it needs to agents, requests count
+// and qps are shared among agents
+func (co *coordinator) prepare() error {
+	if secrets := co.p.c.agentSecrets(); len(secrets) > 0 {
+		for _, agent := range co.agents {
+			if !strings.HasPrefix(strings.ToLower(agentUrl(agent)), "https://") {
+				return fmt.Errorf("%s can't be sent to agent %s over plain http, use an https agent url",
+					strings.Join(secrets, ", "), agent)
+			}
+		}
+	}
+
+	files, err := co.p.c.agentFiles()
+	if err != nil {
+		return err
+	}
+
+	n := len(co.agents)
+	return co.broadcast(func(i int) (string, []byte, error) {
+		c := *co.p.c
+		c.Agents = nil
+		c.Count = share(c.Count, n, i)
+		c.Qps = share(c.Qps, n, i)
+		if co.p.c.Qps > 0 && c.Qps == 0 {
+			c.Qps = 1
+		}
+		b, err := json.Marshal(&agentConfig{Config: c, Files: files})
+		return agentPathPrepare, b, err
+	})
+}
+
+// agentSecrets returns credentials in Config which are shipped to agents,
+// they are never sent over plain http
+func (c *Config) agentSecrets() (secrets []string) {
+	for _, s := range []struct{ name, value string }{
+		{"user", c.User},
+		{"bearer", c.Bearer},
+		{"key", c.Key},
+		{"keyPassword", c.KeyPassword},
+		{"oauth2ClientSecret", c.OAuth2ClientSecret},
+		{"hmacKey", c.HmacKey},
+		{"awsSecretKey", c.AwsSecretKey},
+		{"awsSessionToken", c.AwsSessionToken},
+	} {
+		if s.value != "" {
+			secrets = append(secrets, s.name)
+		}
+	}
+	if c.Cert != "" && c.Key == "" {
+		// a PKCS#12 bundle carries its private key
+		secrets = append(secrets, "cert")
+	}
+	if u, err := url.Parse(c.Url); err == nil && u.User != nil {
+		secrets = append(secrets, "user info of url")
+	}
+	return
+}
+
+// agentFiles reads files which Config refers to on the coordinator,
+// they are shipped to agents by cleaned path
+func (c *Config) agentFiles() (map[string][]byte, error) {
+	paths := []string{c.File, c.Cert, c.Key, c.CaCert, c.Script, c.Scenario, c.ProtoSet}
+	for _, arg := range c.Args {
+		item, err := parseRequestItem(arg)
+		if err != nil {
+			return nil, err
+		}
+		switch item.sep {
+		case sepDataFile, sepJSONFile:
+			paths = append(paths, item.value)
+		case sepFile:
+			file := item.value
+			if j := strings.Index(file, ";type="); j != -1 {
+				file = file[:j]
+			}
+			paths = append(paths, file)
+		}
+	}
+
+	files := make(map[string][]byte)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		path = filepath.Clean(path)
+		if _, ok := files[path]; ok {
+			continue
+		}
+		b, err := c.fs.readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files[path] = b
+	}
+
+	return files, nil
+}
+
+func share(total, n, i int) int {
+	s := total / n
+	if i < total%n {
+		s++
+	}
+	return s
+}
+
+func (co *coordinator) start() error {
+	return co.broadcast(func(int) (string, []byte, error) {
+		return agentPathStart, nil, nil
+	})
+}
+
+func (co *coordinator) stop() error {
+	return co.broadcast(func(int) (string, []byte, error) {
+		return agentPathStop, nil, nil
+	})
+}
+
+// broadcast sends requests to all agents concurrently
+func (co *coordinator) broadcast(build func(i int) (string, []byte, error)) error {
+	errs := make([]error, len(co.agents))
+	var wg sync.WaitGroup
+	wg.Add(len(co.agents))
+	for i := range co.agents {
+		go func(i int) {
+			defer wg.Done()
+			path, body, err := build(i)
+			if err == nil {
+				_, err = co.call(i, path, body)
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// agentUrl adds http scheme to agent address if it's missing
+func agentUrl(agent string) string {
+	if strings.Contains(agent, "://") {
+		return strings.TrimSuffix(agent, "/")
+	}
+	return "http://" + agent
+}
+
+func (co *coordinator) call(i int, path string, body []byte) ([]byte, error) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}()
+
+	req.SetRequestURI(agentUrl(co.agents[i]) + path)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.Set(headerAuthorization, "Bearer "+co.token)
+	req.Header.SetContentType(MIMEApplicationJSON)
+	req.SetBody(body)
+
+	if err := co.client.DoTimeout(req, resp, co.timeout); err != nil {
+		return nil, fmt.Errorf("agent %s: %w", co.agents[i], err)
+	}
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return nil, fmt.Errorf("agent %s: %s", co.agents[i], resp.Body())
+	}
+
+	return append([]byte(nil), resp.Body()...), nil
+}
+
+// run starts agents and merges their statistics every interval
+// until all of them are done
+func (co *coordinator) run() tea.Msg {
+	p := co.p
+	if err := co.start(); err != nil {
+		p.appendError(err)
+		return done
+	}
+
+	ticker := time.NewTicker(agentInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for range ticker.C {
+		var reqs int64
+		allDone := true
+		for i := range co.agents {
+			if co.done[i] {
+				continue
+			}
+
+			s, err := co.stats(i)
+			if err != nil {
+				// drop the agent
+				p.appendError(err)
+				co.done[i] = true
+				continue
+			}
+
+			co.merge(i, s)
+			reqs += s.Reqs
+			co.done[i] = s.Done
+			allDone = allDone && s.Done
+		}
+
+		now := time.Now()
+		elapsed := now.Sub(last)
+		last = now
+
+		p.mut.Lock()
+		p.appendRps(float64(reqs) / elapsed.Seconds())
+		atomic.AddInt64(&p.elapsed, int64(elapsed))
+		p.mut.Unlock()
+
+		if allDone {
+			p.mut.Lock()
+			p.done = true
+			p.mut.Unlock()
+			return done
+		}
+	}
+
+	return done
+}
+
+const agentInterval = time.Millisecond * 100
+
+func (co *coordinator) stats(i int) (*agentStats, error) {
+	b, err := co.call(i, agentPathStats, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &agentStats{}
+	if err = json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("agent %s: %w", co.agents[i], err)
+	}
+
+	return s, nil
+}
+
+// merge merges statistics of agent i into Pit
+func (co *coordinator) merge(i int, s *agentStats) {
+	p := co.p
+
+	atomic.AddInt64(&p.reqs, s.Reqs)
+	atomic.AddInt64(&p.code1xx, s.Codes[0])
+	atomic.AddInt64(&p.code2xx, s.Codes[1])
+	atomic.AddInt64(&p.code3xx, s.Codes[2])
+	atomic.AddInt64(&p.code4xx, s.Codes[3])
+	atomic.AddInt64(&p.code5xx, s.Codes[4])
+	atomic.AddInt64(&p.codeOthers, s.Codes[5])
+
+	p.tui.statsMut.Lock()
+	for latency, n := range s.Latencies {
+		for j := int64(0); j < n; j++ {
+			p.latencies = append(p.latencies, latency)
+		}
+	}
+	p.tui.statsMut.Unlock()
+
+	p.tui.mut.Lock()
+	for err, n := range s.Errors {
+		p.errs[err] += n
+	}
+	p.tui.mut.Unlock()
+
+	atomic.AddInt64(&p.c.throughput, s.Throughput)
+
+	co.sections.mut.Lock()
+	defer co.sections.mut.Unlock()
+
+	for name, hits := range s.Counters {
+		cnt := co.sections.counter(name)
+		for key, n := range hits {
+			cnt.add(key, n-co.counters[i][name][key])
+		}
+	}
+	co.counters[i] = s.Counters
+
+	for name, stats := range s.Groups {
+		for key, gs := range stats {
+			g := co.sections.group(name, gs.Unit)
+			prev := co.groups[i][name][key]
+			g.merge(key, groupStat{
+				reqs:       gs.Reqs - prev.Reqs,
+				errs:       gs.Errs - prev.Errs,
+				latencySum: gs.LatencySum - prev.LatencySum,
+				latencyMax: gs.LatencyMax,
+			})
+		}
+	}
+	co.groups[i] = s.Groups
+
+	for name, stats := range s.Metrics {
+		for key, ms := range stats {
+			m := co.sections.metric(name)
+			prev := co.metrics[i][name][key]
+			m.merge(key, metricStat{
+				count: ms.Count - prev.Count,
+				sum:   ms.Sum - prev.Sum,
+				min:   ms.Min,
+				max:   ms.Max,
+			})
+		}
+	}
+	co.metrics[i] = s.Metrics
+
+	for name, stats := range s.Compressions {
+		for encoding, cs := range stats {
+			cmp := co.sections.compression(name)
+			prev := co.compressions[i][name][encoding]
+			cmp.merge(encoding, compressionStat{
+				count:   cs.Count - prev.Count,
+				wire:    cs.Wire - prev.Wire,
+				decoded: cs.Decoded - prev.Decoded,
+				failed:  cs.Failed - prev.Failed,
+			})
+		}
+	}
+	co.compressions[i] = s.Compressions
+}
+
+// agentSections holds counters, groups, metrics and compressions merged from agents,
+// which are created on demand
+type agentSections struct {
+	mut          sync.Mutex
+	list         []section
+	counters     map[string]*counter
+	groups       map[string]*group
+	metrics      map[string]*metrics
+	compressions map[string]*compression
+}
+
+func (as *agentSections) counter(name string) *counter {
+	cnt, ok := as.counters[name]
+	if !ok {
+		cnt = newCounter(name)
+		as.counters[name] = cnt
+		as.list = append(as.list, cnt)
+	}
+	return cnt
+}
+
+func (as *agentSections) group(name, unit string) *group {
+	g, ok := as.groups[name]
+	if !ok {
+		g = newGroup(name, unit)
+		as.groups[name] = g
+		as.list = append(as.list, g)
+	}
+	return g
+}
+
+func (as *agentSections) metric(name string) *metrics {
+	m, ok := as.metrics[name]
+	if !ok {
+		m = newMetrics(name)
+		as.metrics[name] = m
+		as.list = append(as.list, m)
+	}
+	return m
+}
+
+func (as *agentSections) compression(name string) *compression {
+	cs, ok := as.compressions[name]
+	if !ok {
+		cs = newCompression(name)
+		as.compressions[name] = cs
+		as.list = append(as.list, cs)
+	}
+	return cs
+}
+
+func (as *agentSections) write(buf *bytebufferpool.ByteBuffer) {
+	as.mut.Lock()
+	defer as.mut.Unlock()
+
+	for _, s := range as.list {
+		s.write(buf)
+	}
+}
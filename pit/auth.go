@@ -0,0 +1,214 @@
+package pit
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const headerAuthorization = "Authorization"
+
+// oauth2RetryInterval is the wait before retrying a failed token refresh
+var oauth2RetryInterval = time.Second
+
+var errMultipleAuth = errors.New("only one of user, bearer and oauth2 token url can be specified")
+
+// checkAuth makes sure at most one kind of auth is specified
+func (c *Config) checkAuth() error {
+	n := 0
+	for _, s := range []string{c.User, c.Bearer, c.OAuth2TokenUrl} {
+		if s != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return errMultipleAuth
+	}
+	return nil
+}
+
+// setUserinfo uses user info in url as basic auth credentials
+// if User is not specified
+func (c *Config) setUserinfo(user, password string) {
+	if user != "" && c.User == "" && c.Bearer == "" && c.OAuth2TokenUrl == "" {
+		c.User = user + ":" + password
+	}
+}
+
+// authorization returns Authorization header value of basic or bearer auth
+func (c *Config) authorization() string {
+	switch {
+	case c.User != "":
+		return basicAuth(c.User)
+	case c.Bearer != "":
+		return "Bearer " + c.Bearer
+	}
+	return ""
+}
+
+func basicAuth(userinfo string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(userinfo))
+}
+
+// setReqAuth sets Authorization header of basic or bearer auth, user info
+// in url is removed from request uri and used as basic auth credentials
+func (c *Config) setReqAuth(req *fasthttp.Request) (err error) {
+	uri := req.URI()
+	user, password := string(uri.Username()), string(uri.Password())
+	uri.SetUsername("")
+	uri.SetPassword("")
+
+	if err = c.checkAuth(); err != nil {
+		return
+	}
+	c.setUserinfo(user, password)
+
+	if v := c.authorization(); v != "" {
+		req.Header.Set(headerAuthorization, v)
+	}
+
+	return
+}
+
+// getOAuth2Source fetches the first token if OAuth2TokenUrl is specified
+func (c *Config) getOAuth2Source() (*oauth2Source, error) {
+	if c.OAuth2TokenUrl == "" {
+		return nil, nil
+	}
+
+	s := &oauth2Source{
+		tokenUrl:     c.OAuth2TokenUrl,
+		clientId:     c.OAuth2ClientId,
+		clientSecret: c.OAuth2ClientSecret,
+		scopes:       c.OAuth2Scopes,
+		timeout:      c.Timeout,
+		// tls options like sni, alpn and ca certs are for the target,
+		// the token server only honours insecure
+		client: &fasthttp.Client{
+			Name: "httpit/" + Version,
+			/* #nosec G402 */
+			TLSConfig: &tls.Config{InsecureSkipVerify: c.Insecure},
+		},
+	}
+
+	if err := s.fetch(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// oauth2Source provides tokens of OAuth2 client credentials flow, a token
+// is refreshed in background when 80% of its lifetime is passed
+type oauth2Source struct {
+	tokenUrl     string
+	clientId     string
+	clientSecret string
+	scopes       []string
+	timeout      time.Duration
+	client       *fasthttp.Client
+
+	mut        sync.RWMutex
+	value      string
+	refreshAt  time.Time
+	refreshing int32
+}
+
+type oauth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// authorization returns Authorization header value of current token,
+// and starts refreshing it if it's time
+func (s *oauth2Source) authorization() string {
+	s.mut.RLock()
+	value, refreshAt := s.value, s.refreshAt
+	s.mut.RUnlock()
+
+	if !refreshAt.IsZero() && time.Now().After(refreshAt) &&
+		atomic.CompareAndSwapInt32(&s.refreshing, 0, 1) {
+		go s.refresh()
+	}
+
+	return value
+}
+
+func (s *oauth2Source) refresh() {
+	defer atomic.StoreInt32(&s.refreshing, 0)
+
+	if err := s.fetch(); err != nil {
+		// keep current token and retry later
+		s.mut.Lock()
+		s.refreshAt = time.Now().Add(oauth2RetryInterval)
+		s.mut.Unlock()
+	}
+}
+
+// fetch requests a new token from token url
+func (s *oauth2Source) fetch() error {
+	req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}()
+
+	args := fasthttp.AcquireArgs()
+	args.Set("grant_type", "client_credentials")
+	if len(s.scopes) > 0 {
+		args.Set("scope", strings.Join(s.scopes, " "))
+	}
+	req.SetBody(args.QueryString())
+	fasthttp.ReleaseArgs(args)
+
+	req.SetRequestURI(s.tokenUrl)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType(MIMEApplicationForm)
+	req.Header.Set("Accept", MIMEApplicationJSON)
+	req.Header.Set(headerAuthorization, basicAuth(url.QueryEscape(s.clientId)+":"+url.QueryEscape(s.clientSecret)))
+
+	start := time.Now()
+	if err := s.client.DoTimeout(req, resp, s.timeout); err != nil {
+		return fmt.Errorf("failed to fetch oauth2 token: %w", err)
+	}
+
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return fmt.Errorf("failed to fetch oauth2 token: %d %s", resp.StatusCode(), resp.Body())
+	}
+
+	var token oauth2Token
+	if err := json.Unmarshal(resp.Body(), &token); err != nil {
+		return fmt.Errorf("failed to parse oauth2 token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return errors.New("failed to parse oauth2 token: missing access_token")
+	}
+
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+
+	var refreshAt time.Time
+	if token.ExpiresIn > 0 {
+		lifetime := time.Duration(token.ExpiresIn) * time.Second
+		refreshAt = start.Add(lifetime * 4 / 5)
+	}
+
+	s.mut.Lock()
+	s.value = tokenType + " " + token.AccessToken
+	s.refreshAt = refreshAt
+	s.mut.Unlock()
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package pit
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// keys of connection churn
+const (
+	churnOpened      = "opened"
+	churnMaxRequests = "closed by max requests"
+	churnMaxDuration = "closed by max duration"
+	churnIdleTimeout = "closed by idle timeout"
+	churnOthers      = "closed by others"
+)
+
+// connPolicy closes connections after max requests, max duration or idle
+// timeout to simulate clients which redial often, and records the churn.
+// Max duration and idle timeout are applied by fasthttp clients, and
+// max requests are applied by connections.
+type connPolicy struct {
+	maxRequests int
+	maxDuration time.Duration
+	idleTimeout time.Duration
+	// tlsConf is used to do tls handshakes by connections themselves,
+	// so that requests are counted in plaintext, it's nil if not tls
+	tlsConf *tls.Config
+	timeout time.Duration
+	stats   *counter
+}
+
+// newConnPolicy returns nil if no policy is specified
+func (c *Config) newConnPolicy() (*connPolicy, error) {
+	if c.MaxConnRequests <= 0 && c.MaxConnDuration <= 0 && c.IdleConnTimeout <= 0 {
+		return nil, nil
+	}
+
+	switch {
+	case c.Http2:
+		return nil, errors.New("connection churn controls don't work with http2")
+	case c.Pipeline && (c.MaxConnRequests > 0 || c.MaxConnDuration > 0):
+		return nil, errors.New("max requests and max duration of connections don't work with pipeline")
+	case c.Stream && c.MaxConnRequests > 0:
+		// requests of stream body can't be retried on new connections
+		return nil, errors.New("max requests of connections doesn't work with stream body")
+	}
+
+	p := &connPolicy{
+		maxRequests: c.MaxConnRequests,
+		maxDuration: c.MaxConnDuration,
+		idleTimeout: c.IdleConnTimeout,
+		timeout:     c.Timeout,
+		stats:       c.newCounter("Connection churn"),
+	}
+	if p.idleTimeout <= 0 {
+		p.idleTimeout = fasthttp.DefaultMaxIdleConnDuration
+	}
+	if c.isTLS {
+		p.tlsConf = c.tlsClientConf()
+	}
+
+	return p, nil
+}
+
+// dialer wraps dial to apply the policy to new connections
+func (p *connPolicy) dialer(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := conn.(interface{ Handshake() error }); p.tlsConf != nil && !ok {
+			tc := tls.Client(conn, p.tlsConf)
+			if p.timeout > 0 {
+				_ = tc.SetDeadline(time.Now().Add(p.timeout))
+			}
+			if err = tc.Handshake(); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+			_ = tc.SetDeadline(time.Time{})
+			conn = tc
+		}
+
+		p.stats.add(churnOpened, 1)
+		now := time.Now()
+		return &churnConn{Conn: conn, p: p, created: now, lastUse: now.UnixNano()}, nil
+	}
+}
+
+// churnConn counts requests by writes after reads, a request is
+// written after the response of the previous one is read. Pipeline
+// clients read and write a connection in different goroutines, so
+// that fields shared by reads, writes and close are atomic.
+type churnConn struct {
+	net.Conn
+	p       *connPolicy
+	created time.Time
+	// lastUse is unix nanoseconds of the last read or write
+	lastUse int64
+	// requests is only used by writes
+	requests int
+	writing  int32
+	reason   atomic.Value
+	closed   int32
+}
+
+func (cc *churnConn) Write(b []byte) (int, error) {
+	if atomic.SwapInt32(&cc.writing, 1) == 0 {
+		if cc.p.maxRequests > 0 && cc.requests >= cc.p.maxRequests {
+			// act like a server closing an idle connection,
+			// so that the request is retried on a new one
+			cc.reason.Store(churnMaxRequests)
+			return 0, io.EOF
+		}
+		cc.requests++
+	}
+
+	atomic.StoreInt64(&cc.lastUse, time.Now().UnixNano())
+	return cc.Conn.Write(b)
+}
+
+func (cc *churnConn) Read(b []byte) (int, error) {
+	atomic.StoreInt32(&cc.writing, 0)
+	n, err := cc.Conn.Read(b)
+	atomic.StoreInt64(&cc.lastUse, time.Now().UnixNano())
+	return n, err
+}
+
+// Handshake tells fasthttp clients that tls is done by dialer
+func (cc *churnConn) Handshake() error {
+	return nil
+}
+
+func (cc *churnConn) Close() error {
+	if atomic.CompareAndSwapInt32(&cc.closed, 0, 1) {
+		cc.p.stats.add(cc.closeReason(), 1)
+	}
+	return cc.Conn.Close()
+}
+
+func (cc *churnConn) closeReason() string {
+	now := time.Now()
+	if reason, _ := cc.reason.Load().(string); reason != "" {
+		return reason
+	}
+	switch {
+	case now.Sub(time.Unix(0, atomic.LoadInt64(&cc.lastUse))) >= cc.p.idleTimeout:
+		return churnIdleTimeout
+	case cc.p.maxDuration > 0 && now.Sub(cc.created) >= cc.p.maxDuration:
+		return churnMaxDuration
+	}
+	return churnOthers
+}
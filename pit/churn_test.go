@@ -0,0 +1,108 @@
+package pit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_ConnPolicy(t *testing.T) {
+	t.Parallel()
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Run("max requests", func(t *testing.T) {
+		r, err := RunHandler(context.Background(), Config{
+			Method:          fasthttp.MethodPost,
+			Connections:     2,
+			Duration:        time.Millisecond * 200,
+			MaxConnRequests: 5,
+		}, handler)
+		assert.Nil(t, err)
+		assert.Empty(t, r.Errors)
+
+		churn := r.Counters["Connection churn"]
+		assert.True(t, churn[churnMaxRequests] > 0)
+		assert.InDelta(t, r.Requests/5, churn[churnOpened], 3)
+	})
+
+	t.Run("max duration", func(t *testing.T) {
+		r, err := RunHandler(context.Background(), Config{
+			Connections:     2,
+			Duration:        time.Millisecond * 200,
+			MaxConnDuration: time.Millisecond * 20,
+		}, handler)
+		assert.Nil(t, err)
+		assert.Empty(t, r.Errors)
+
+		churn := r.Counters["Connection churn"]
+		assert.True(t, churn[churnMaxDuration] > 0)
+		assert.True(t, churn[churnOpened] > 2)
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		t.Cleanup(ts.Close)
+
+		r, err := New(Config{
+			Url:             ts.URL,
+			Insecure:        true,
+			Connections:     2,
+			Duration:        time.Millisecond * 200,
+			MaxConnRequests: 3,
+		}).RunContext(context.Background())
+		assert.Nil(t, err)
+		assert.Empty(t, r.Errors)
+		assert.True(t, r.Code2xx > 0)
+		assert.True(t, r.Counters["Connection churn"][churnMaxRequests] > 0)
+	})
+
+	t.Run("pipeline with idle timeout", func(t *testing.T) {
+		// pipeline clients read and write connections concurrently
+		r, err := RunHandler(context.Background(), Config{
+			Pipeline:        true,
+			IdleConnTimeout: time.Second,
+			Connections:     16,
+			Count:           2000,
+		}, handler)
+		assert.Nil(t, err)
+		assert.Empty(t, r.Errors)
+		assert.True(t, r.Counters["Connection churn"][churnOpened] > 0)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, c := range []Config{
+			{Url: "http://localhost", MaxConnRequests: 1, Http2: true},
+			{Url: "http://localhost", MaxConnDuration: time.Second, Pipeline: true},
+			{Url: "http://localhost", MaxConnRequests: 1, Stream: true},
+		} {
+			assert.NotNil(t, New(c).init())
+		}
+	})
+}
+
+func Test_churnConn_closeReason(t *testing.T) {
+	t.Parallel()
+
+	p := &connPolicy{maxDuration: time.Minute, idleTimeout: time.Second, stats: newCounter("churn")}
+	now := time.Now()
+
+	cc := &churnConn{p: p, created: now, lastUse: now.UnixNano()}
+	assert.Equal(t, churnOthers, cc.closeReason())
+
+	cc.lastUse = now.Add(-time.Second).UnixNano()
+	assert.Equal(t, churnIdleTimeout, cc.closeReason())
+
+	cc.created, cc.lastUse = now.Add(-time.Minute), now.UnixNano()
+	assert.Equal(t, churnMaxDuration, cc.closeReason())
+
+	cc.reason.Store(churnMaxRequests)
+	assert.Equal(t, churnMaxRequests, cc.closeReason())
+}
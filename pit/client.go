@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"sync"
 	"time"
@@ -38,7 +39,15 @@ type fasthttpClient struct {
 	rawReq         *fasthttp.Request
 	body           []byte
 	stream         bool
+	multipart      *multipartBody
 	maxRedirects   int
+	remoteAddrs    *group
+	respBodies     *compression
+	decompress     bool
+	oauth2         *oauth2Source
+	signer         Signer
+	trace          *debugTrace
+	pipeline       *pipelineStats
 	wc             io.WriteCloser
 }
 
@@ -47,10 +56,14 @@ func newFasthttpClient(c *Config) (fc *fasthttpClient, err error) {
 		maxRedirects: c.getMaxRedirects(),
 		rawReq:       fasthttp.AcquireRequest(),
 		stream:       c.Stream,
+		remoteAddrs:  c.remoteAddrs,
 		wc:           defaultWriteCloser{Writer: os.Stdout},
 	}
 
-	c.parseArgs()
+	if err = c.parseArgs(); err != nil {
+		return
+	}
+	fc.multipart = c.multipart
 
 	if err = c.setReqBasic(fc.rawReq); err != nil {
 		return
@@ -60,18 +73,54 @@ func newFasthttpClient(c *Config) (fc *fasthttpClient, err error) {
 	}
 	fc.body = c.body
 
+	if c.rawBodySize > 0 {
+		// every request sends the same body, so it's recorded once
+		c.newCompression("Request compression").add("gzip", len(c.body), c.rawBodySize)
+	}
+	if c.Compressed || c.Decompress {
+		fc.respBodies = c.newCompression("Response compression")
+		fc.decompress = c.Decompress
+	}
+
 	if err = c.setReqHeader(fc.rawReq); err != nil {
 		return
 	}
+	if err = c.setReqAuth(fc.rawReq); err != nil {
+		return
+	}
 
 	if c.tlsConf, err = c.getTlsConfig(); err != nil {
 		return
 	}
 
+	if fc.oauth2, err = c.getOAuth2Source(); err != nil {
+		return
+	}
+
+	if fc.signer, err = c.getSigner(); err != nil {
+		return
+	}
+
 	if c.Debug {
 		fc.rawReq.SetConnectionClose()
+		c.debugTrace = newDebugTrace(c)
+		fc.trace = c.debugTrace
 		fc.onceDoer, err = c.hostClient()
 	} else {
+		if c.Handshake != "" {
+			if c.handshaker, err = newHandshaker(c); err != nil {
+				return
+			}
+			// every request does a handshake on a new connection
+			fc.rawReq.SetConnectionClose()
+		}
+		if c.connPolicy, err = c.newConnPolicy(); err != nil {
+			return
+		}
+		if c.Pipeline {
+			c.pipeline = c.newPipelineStats()
+			fc.pipeline = c.pipeline
+		}
 		fc.doer, err = c.doer()
 	}
 
@@ -90,9 +139,17 @@ func (c *fasthttpClient) do() (code int, latency time.Duration, err error) {
 	}()
 
 	if c.stream {
-		bodyStream := c.acquireBodyStream()
-		req.SetBodyStream(bodyStream, -1)
-		c.bodyStreamPool.Put(bodyStream)
+		if err = c.setBodyStream(req); err != nil {
+			return
+		}
+	}
+
+	if err = c.sign(req); err != nil {
+		return
+	}
+
+	if c.pipeline != nil {
+		c.pipeline.begin()
 	}
 
 	start := time.Now()
@@ -101,20 +158,79 @@ func (c *fasthttpClient) do() (code int, latency time.Duration, err error) {
 	}
 
 	code = resp.StatusCode()
-	latency = time.Since(start)
+	end := time.Now()
+	latency = end.Sub(start)
+
+	if c.pipeline != nil {
+		c.pipeline.end(resp.LocalAddr(), start, end)
+	}
+
+	if c.remoteAddrs != nil {
+		c.remoteAddrs.add(remoteIP(resp.RemoteAddr()), latency, nil)
+	}
+
+	c.recordResponse(resp)
 
 	return
 }
 
-func (c *fasthttpClient) acquireReq() *fasthttp.Request {
-	v := c.reqPool.Get()
-	if v == nil {
-		req := fasthttp.AcquireRequest()
+// recordResponse records the body size of resp if responses are compressed
+func (c *fasthttpClient) recordResponse(resp *fasthttp.Response) {
+	if c.respBodies != nil {
+		c.respBodies.recordResponse(resp, c.decompress)
+	}
+}
+
+// remoteIP returns ip of the remote address
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return "unknown"
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
+
+func (c *fasthttpClient) acquireReq() (req *fasthttp.Request) {
+	if v := c.reqPool.Get(); v != nil {
+		req = v.(*fasthttp.Request)
+	} else {
+		req = fasthttp.AcquireRequest()
 		c.rawReq.CopyTo(req)
-		return req
 	}
 
-	return v.(*fasthttp.Request)
+	if c.oauth2 != nil {
+		req.Header.Set(headerAuthorization, c.oauth2.authorization())
+	}
+
+	return
+}
+
+// sign signs req right before it's sent if there is a signer
+func (c *fasthttpClient) sign(req *fasthttp.Request) error {
+	if c.signer == nil {
+		return nil
+	}
+	return c.signer.Sign(req, c.body)
+}
+
+// setBodyStream sets body stream of req, a multipart body is
+// streamed with its files
+func (c *fasthttpClient) setBodyStream(req *fasthttp.Request) error {
+	if c.multipart != nil {
+		bodyStream, size, err := c.multipart.open()
+		if err != nil {
+			return err
+		}
+		req.SetBodyStream(bodyStream, size)
+		return nil
+	}
+
+	bodyStream := c.acquireBodyStream()
+	req.SetBodyStream(bodyStream, -1)
+	c.bodyStreamPool.Put(bodyStream)
+	return nil
 }
 
 func (c *fasthttpClient) acquireBodyStream() *bytes.Reader {
@@ -132,31 +248,87 @@ func (c *fasthttpClient) doOnce() (err error) {
 		req  = c.rawReq
 		resp = fasthttp.AcquireResponse()
 	)
+	defer fasthttp.ReleaseResponse(resp)
 
 	if c.stream {
-		req.SetBodyStream(bytes.NewReader(c.body), -1)
+		if err = c.setBodyStream(req); err != nil {
+			return
+		}
 	}
 
-	defer func() {
-		if err == nil {
-			// output debug info
-			// ignore all errors
-			msg := fmt.Sprintf("Connected to %s(%v)\r\n\r\n", req.URI().Host(), resp.RemoteAddr())
-			_, _ = c.wc.Write([]byte(msg))
-			_, _ = req.WriteTo(c.wc)
-			_, _ = c.wc.Write([]byte("\n\n"))
-			_, _ = resp.WriteTo(c.wc)
-			_ = c.wc.Close()
+	if c.oauth2 != nil {
+		req.Header.Set(headerAuthorization, c.oauth2.authorization())
+	}
+
+	if err = c.sign(req); err != nil {
+		return
+	}
+
+	// follow redirects by hand to show every hop
+	redirects := 0
+	for ; ; redirects++ {
+		var latency time.Duration
+		if latency, err = c.doDebug(req, resp); err != nil {
+			// show the tls info which may explain the error
+			c.trace.writeTLS(c.wc)
+			return
 		}
-	}()
 
-	if c.maxRedirects > 0 {
-		err = c.onceDoer.DoRedirects(c.rawReq, resp, c.maxRedirects)
-	} else {
-		err = c.onceDoer.Do(c.rawReq, resp)
+		if c.maxRedirects == 0 || !fasthttp.StatusCodeIsRedirect(resp.StatusCode()) {
+			break
+		}
+		if redirects == c.maxRedirects {
+			return fasthttp.ErrTooManyRedirects
+		}
+		location := resp.Header.Peek(fasthttp.HeaderLocation)
+		if len(location) == 0 {
+			return fasthttp.ErrMissingLocation
+		}
+
+		writeHop(c.wc, redirects+1, req, resp, latency)
+		req.URI().UpdateBytes(location)
 	}
 
-	return
+	if redirects > 0 {
+		_, _ = io.WriteString(c.wc, "\n")
+	}
+	c.writeDebug(req, resp)
+
+	return c.wc.Close()
+}
+
+// doDebug sends req once in debug mode and traces it
+func (c *fasthttpClient) doDebug(req *fasthttp.Request, resp *fasthttp.Response) (time.Duration, error) {
+	c.trace.reset()
+	start := time.Now()
+	err := c.onceDoer.Do(req, resp)
+	c.trace.finish()
+	return time.Since(start), err
+}
+
+// writeDebug outputs request and response with pretty bodies and timings
+// in debug mode, all errors are ignored
+func (c *fasthttpClient) writeDebug(req *fasthttp.Request, resp *fasthttp.Response) {
+	_, _ = fmt.Fprintf(c.wc, "Connected to %s(%v)\n\n", req.URI().Host(), resp.RemoteAddr())
+	c.trace.writeTLS(c.wc)
+
+	writeHeader(c.wc, req.Header.Header())
+	writeBody(c.wc, req.Body(), string(req.Header.ContentType()))
+	_, _ = io.WriteString(c.wc, "\n")
+
+	writeHeader(c.wc, resp.Header.Header())
+	body := resp.Body()
+	if len(resp.Header.ContentEncoding()) > 0 {
+		if b, err := resp.BodyUncompressed(); err == nil {
+			body = b
+		}
+	}
+	writeBody(c.wc, body, string(resp.Header.ContentType()))
+
+	if c.trace != nil {
+		_, _ = io.WriteString(c.wc, "\n")
+		c.trace.write(c.wc)
+	}
 }
 
 type discardLogger struct{}
@@ -3,6 +3,7 @@ package pit
 import (
 	"bytes"
 	"errors"
+	"net"
 	"testing"
 	"time"
 
@@ -86,6 +87,22 @@ func Test_Fastclient_Do(t *testing.T) {
 			assert.Equal(t, code, 400)
 		}
 	})
+
+	t.Run("remote addresses", func(t *testing.T) {
+		f.doer = getFakeDoer(200, t)
+		f.remoteAddrs = newGroup("Remote addresses", "reqs")
+		_, _, err := f.do()
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), f.remoteAddrs.get("unknown").reqs)
+	})
+}
+
+func Test_remoteIP(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "unknown", remoteIP(nil))
+	assert.Equal(t, "1.1.1.1", remoteIP(&net.TCPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 80}))
+	assert.Equal(t, "/app.sock", remoteIP(&net.UnixAddr{Name: "/app.sock", Net: "unix"}))
 }
 
 func Test_Fastclient_DoRedirects(t *testing.T) {
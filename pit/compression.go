@@ -0,0 +1,172 @@
+package pit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strconv"
+	"sync"
+
+	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerAcceptEncoding  = "Accept-Encoding"
+	headerContentEncoding = "Content-Encoding"
+	acceptEncodings       = "gzip, deflate, br"
+	encodingIdentity      = "identity"
+)
+
+// compression collects body sizes on the wire and after decoding by content
+// encoding concurrently, it keeps encodings in the order of their first
+// appearance
+type compression struct {
+	name  string
+	mut   sync.Mutex
+	keys  []string
+	stats map[string]*compressionStat
+}
+
+type compressionStat struct {
+	count int64
+	// wire is the size of bodies as they are transferred
+	wire int64
+	// decoded is the size of bodies after decoding, it's 0 if
+	// bodies are not decoded
+	decoded int64
+	// failed is the number of bodies which failed to decode, they
+	// are not counted in count, wire and decoded
+	failed int64
+}
+
+func newCompression(name string) *compression {
+	return &compression{
+		name:  name,
+		stats: make(map[string]*compressionStat),
+	}
+}
+
+// add records a body of encoding
+func (c *compression) add(encoding string, wire, decoded int) {
+	c.merge(encoding, compressionStat{count: 1, wire: int64(wire), decoded: int64(decoded)})
+}
+
+// merge merges a stat of encoding
+func (c *compression) merge(encoding string, cs compressionStat) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	s, ok := c.stats[encoding]
+	if !ok {
+		s = &compressionStat{}
+		c.stats[encoding] = s
+		c.keys = append(c.keys, encoding)
+	}
+
+	s.count += cs.count
+	s.wire += cs.wire
+	s.decoded += cs.decoded
+	s.failed += cs.failed
+}
+
+// each calls fn with every encoding and its stat in order
+func (c *compression) each(fn func(encoding string, cs compressionStat)) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for _, key := range c.keys {
+		fn(key, *c.stats[key])
+	}
+}
+
+func (c *compression) get(encoding string) compressionStat {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if s, ok := c.stats[encoding]; ok {
+		return *s
+	}
+	return compressionStat{}
+}
+
+// ratio is decoded size divided by wire size
+func (cs compressionStat) ratio() float64 {
+	if cs.wire == 0 || cs.decoded == 0 {
+		return 0
+	}
+	return float64(cs.decoded) / float64(cs.wire)
+}
+
+func (c *compression) write(buf *bytebufferpool.ByteBuffer) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if len(c.keys) == 0 {
+		return
+	}
+
+	_, _ = buf.WriteString(c.name)
+	_, _ = buf.WriteString(":\n")
+	for _, key := range c.keys {
+		s := c.stats[key]
+		_, _ = buf.WriteString("  ")
+		_, _ = buf.WriteString(key)
+		_, _ = buf.WriteString(" - bodies ")
+		buf.B = fasthttp.AppendUint(buf.B, int(s.count))
+		_, _ = buf.WriteString(", wire ")
+		writeSize(buf, s.wire)
+		if s.decoded > 0 {
+			_, _ = buf.WriteString(", decoded ")
+			writeSize(buf, s.decoded)
+			_, _ = buf.WriteString(", ratio ")
+			buf.B = strconv.AppendFloat(buf.B, s.ratio(), 'f', 2, 64)
+			_ = buf.WriteByte('x')
+		}
+		if s.failed > 0 {
+			_, _ = buf.WriteString(", decode errors ")
+			buf.B = fasthttp.AppendUint(buf.B, int(s.failed))
+		}
+		_ = buf.WriteByte('\n')
+	}
+}
+
+func writeSize(buf *bytebufferpool.ByteBuffer, n int64) {
+	size, unit := formatSize(float64(n))
+	buf.B = strconv.AppendFloat(buf.B, size, 'f', 2, 64)
+	_, _ = buf.WriteString(unit)
+}
+
+// recordResponse records the body size of resp, and its decoded size
+// if decode is true. A body which fails to decode is recorded as a
+// decode error of its encoding, the request itself is fine.
+func (c *compression) recordResponse(resp *fasthttp.Response, decode bool) {
+	encoding := string(resp.Header.ContentEncoding())
+	if encoding == "" {
+		encoding = encodingIdentity
+	}
+
+	wire, decoded := len(resp.Body()), 0
+	if decode {
+		body, err := resp.BodyUncompressed()
+		if err != nil {
+			c.merge(encoding, compressionStat{failed: 1})
+			return
+		}
+		decoded = len(body)
+	}
+
+	c.add(encoding, wire, decoded)
+}
+
+// gzipBody compresses body with gzip
+func gzipBody(body []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
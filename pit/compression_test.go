@@ -0,0 +1,97 @@
+package pit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_compression(t *testing.T) {
+	t.Parallel()
+
+	cs := newCompression("Compression")
+
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	cs.write(buf)
+	assert.Equal(t, "", buf.String())
+
+	cs.add("gzip", 100, 500)
+	cs.add("gzip", 300, 1500)
+	cs.add(encodingIdentity, 2000, 0)
+	cs.merge("br", compressionStat{failed: 1})
+
+	assert.Equal(t, compressionStat{count: 2, wire: 400, decoded: 2000}, cs.get("gzip"))
+	assert.Equal(t, float64(5), cs.get("gzip").ratio())
+	assert.Equal(t, float64(0), cs.get(encodingIdentity).ratio())
+	assert.Equal(t, compressionStat{failed: 1}, cs.get("br"))
+	assert.Equal(t, compressionStat{}, cs.get("deflate"))
+
+	cs.write(buf)
+	assert.Equal(t, "Compression:\n"+
+		"  gzip - bodies 2, wire 400.00B, decoded 2.00KB, ratio 5.00x\n"+
+		"  identity - bodies 1, wire 2.00KB\n"+
+		"  br - bodies 0, wire 0.00B, decode errors 1\n", buf.String())
+}
+
+func Test_Compression_Decode_Error(t *testing.T) {
+	t.Parallel()
+
+	r, err := RunHandler(context.Background(), Config{
+		Decompress: true,
+		Count:      10,
+	}, func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.SetBodyRaw([]byte("not gzip"))
+		ctx.Response.Header.Set(headerContentEncoding, "gzip")
+	})
+
+	assert.Nil(t, err)
+	assert.Empty(t, r.Errors)
+	assert.Equal(t, int64(10), r.Code2xx)
+
+	resp := r.Compressions["Response compression"]["gzip"]
+	assert.Zero(t, resp.Bodies)
+	assert.True(t, resp.DecodeErrors >= 10)
+}
+
+func Test_Compression_Every_Request(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat("httpit", 100)
+	r, err := RunHandler(context.Background(), Config{
+		Method:     fasthttp.MethodPost,
+		Body:       body,
+		GzipBody:   true,
+		Compressed: true,
+		Decompress: true,
+		Count:      10,
+	}, func(ctx *fasthttp.RequestCtx) {
+		reqBody, err := ctx.Request.BodyGunzip()
+		if err != nil || string(reqBody) != body ||
+			!strings.Contains(string(ctx.Request.Header.Peek(headerAcceptEncoding)), "br") {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			return
+		}
+		ctx.Response.SetBodyRaw(fasthttp.AppendBrotliBytes(nil, reqBody))
+		ctx.Response.Header.Set(headerContentEncoding, "br")
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), r.Code2xx)
+
+	// the same body is sent every time, so it's recorded once
+	req := r.Compressions["Request compression"]["gzip"]
+	assert.Equal(t, int64(1), req.Bodies)
+	assert.Equal(t, int64(len(body)), req.DecodedBytes)
+	assert.True(t, req.Ratio > 1)
+
+	resp := r.Compressions["Response compression"]["br"]
+	assert.True(t, resp.Bodies >= 10)
+	assert.Equal(t, int64(len(body))*resp.Bodies, resp.DecodedBytes)
+	assert.True(t, resp.Ratio > 1)
+}
@@ -2,6 +2,7 @@ package pit
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/valyala/fasthttp"
@@ -66,12 +67,27 @@ func Test_Config_parseArgs(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			c, _ := configAndReq()
 			c.Args = tc.args
-			c.parseArgs()
+			assert.Nil(t, c.parseArgs())
 			assert.Equal(t, tc.isForm, c.Form)
 			assert.Equal(t, tc.isJson, c.JSON)
 			assert.Equal(t, tc.expected, string(c.body))
 		})
 	}
+
+	t.Run("multipart", func(t *testing.T) {
+		c, req := configAndReq()
+		c.Args = []string{"name=foo", "file@" + writeFile(t, "a.txt", "a")}
+		assert.Nil(t, c.parseArgs())
+		assert.False(t, c.Form)
+		assert.Equal(t, fasthttp.MethodPost, c.Method)
+		assert.Contains(t, string(c.body), "a\r\n")
+		assert.Nil(t, c.setReqHeader(req))
+		assert.Equal(t, c.multipart.contentType, string(req.Header.ContentType()))
+
+		c, _ = configAndReq()
+		c.Args = []string{"file@not-exist"}
+		assert.NotNil(t, c.parseArgs())
+	})
 }
 
 func Test_Config_setReqBody(t *testing.T) {
@@ -106,6 +122,18 @@ func Test_Config_setReqBody(t *testing.T) {
 		assert.Nil(t, c.setReqBody(req))
 		assert.Equal(t, c.body, req.Body())
 	})
+
+	t.Run("gzip", func(t *testing.T) {
+		c, req := configAndReq()
+		c.Body = "body"
+		c.GzipBody = true
+		assert.Nil(t, c.setReqBody(req))
+		assert.Equal(t, 4, c.rawBodySize)
+		assert.Equal(t, "gzip", string(req.Header.Peek(headerContentEncoding)))
+		body, err := req.BodyGunzip()
+		assert.Nil(t, err)
+		assert.Equal(t, "body", string(body))
+	})
 }
 
 func Test_Config_setReqHeader(t *testing.T) {
@@ -152,6 +180,19 @@ func Test_Config_setReqHeader(t *testing.T) {
 		assert.Nil(t, c.setReqHeader(req))
 		assert.Equal(t, MIMEApplicationForm, string(req.Header.ContentType()))
 	})
+
+	t.Run("compressed", func(t *testing.T) {
+		c, req := configAndReq()
+		c.Compressed = true
+		assert.Nil(t, c.setReqHeader(req))
+		assert.Equal(t, acceptEncodings, string(req.Header.Peek(headerAcceptEncoding)))
+
+		c, req = configAndReq()
+		c.Compressed = true
+		c.Headers = []string{"Accept-Encoding: br"}
+		assert.Nil(t, c.setReqHeader(req))
+		assert.Equal(t, "br", string(req.Header.Peek(headerAcceptEncoding)))
+	})
 }
 
 func configAndReq() (*Config, *fasthttp.Request) {
@@ -180,14 +221,6 @@ func Test_getMaxRedirects(t *testing.T) {
 	})
 }
 
-func Test_readClientCert(t *testing.T) {
-	t.Parallel()
-
-	cert, err := readClientCert("testdata/ssl.pem", "testdata/ssl.key")
-	assert.Nil(t, err)
-	assert.Len(t, cert, 1)
-}
-
 func Test_addMissingPort(t *testing.T) {
 	t.Parallel()
 
@@ -209,6 +242,94 @@ func Test_Config_hostClient(t *testing.T) {
 	}
 
 	hc, err := c.hostClient()
-	assert.Nil(t, hc)
-	assert.EqualError(t, err, "127.0.0.1:8443 doesn't support http/2\n")
+	assert.Nil(t, err)
+	assert.NotNil(t, hc.Transport)
+}
+
+func Test_Config_streamResponse(t *testing.T) {
+	t.Parallel()
+
+	c := &Config{StreamResponse: true, addr: "127.0.0.1:8080", Timeout: time.Second}
+	hc, err := c.hostClient()
+	assert.Nil(t, err)
+	assert.True(t, hc.StreamResponseBody)
+	assert.Equal(t, time.Duration(0), hc.ReadTimeout)
+
+	c.Debug = true
+	hc, err = c.hostClient()
+	assert.Nil(t, err)
+	assert.False(t, hc.StreamResponseBody)
+}
+
+func Test_Config_parseResolve(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty", func(t *testing.T) {
+		c := &Config{}
+		assert.Nil(t, c.parseResolve())
+		assert.Nil(t, c.remoteAddrs)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		c := &Config{Resolve: []string{"example.com:80"}}
+		assert.EqualError(t, c.parseResolve(), "failed to parse resolve example.com:80, format is host:port:addr[,addr]...")
+	})
+
+	t.Run("invalid address", func(t *testing.T) {
+		c := &Config{Resolve: []string{"example.com:80:1.1.1.1,foo"}}
+		assert.EqualError(t, c.parseResolve(), `failed to parse resolve example.com:80:1.1.1.1,foo, invalid address "foo"`)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		c := &Config{Resolve: []string{"example.com:80:1.1.1.1, [::1]", "example.com:443:2.2.2.2"}}
+		assert.Nil(t, c.parseResolve())
+		assert.Equal(t, map[string][]string{
+			"example.com:80":  {"1.1.1.1", "::1"},
+			"example.com:443": {"2.2.2.2"},
+		}, c.resolves)
+		assert.NotNil(t, c.remoteAddrs)
+		assert.Len(t, c.sections, 1)
+	})
+}
+
+func Test_Config_parseLocalAddrs(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty", func(t *testing.T) {
+		c := &Config{}
+		assert.Nil(t, c.parseLocalAddrs())
+		assert.Nil(t, c.localAddrs)
+	})
+
+	testCases := []struct {
+		addr string
+		err  string
+	}{
+		{"foo", `invalid local address "foo"`},
+		{"10.0.0.0/33", `invalid local address "10.0.0.0/33"`},
+		{"10.0.0.0/8", `local address "10.0.0.0/8" is too large, the limit is 65536 addresses`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.addr, func(t *testing.T) {
+			c := &Config{LocalAddrs: []string{tc.addr}}
+			assert.EqualError(t, c.parseLocalAddrs(), tc.err)
+		})
+	}
+
+	t.Run("too many", func(t *testing.T) {
+		c := &Config{LocalAddrs: []string{"10.0.0.0/16", "10.1.0.0/16"}}
+		assert.EqualError(t, c.parseLocalAddrs(), "too many local addresses, the limit is 65536")
+	})
+
+	t.Run("success", func(t *testing.T) {
+		c := &Config{LocalAddrs: []string{"10.0.0.2", " 10.0.1.0/30", "10.0.2.0/31", "fe80::/127"}}
+		assert.Nil(t, c.parseLocalAddrs())
+		var ips []string
+		for _, ip := range c.localIPs {
+			ips = append(ips, ip.String())
+		}
+		assert.Equal(t, []string{"10.0.0.2", "10.0.1.1", "10.0.1.2", "10.0.2.0", "10.0.2.1", "fe80::", "fe80::1"}, ips)
+		assert.NotNil(t, c.localAddrs)
+	})
 }
@@ -0,0 +1,78 @@
+package pit
+
+import (
+	"sync"
+
+	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
+)
+
+// counter counts hits by key concurrently, it keeps keys
+// in the order of their first appearance
+type counter struct {
+	name string
+	mut  sync.Mutex
+	keys []string
+	hits map[string]int64
+}
+
+func newCounter(name string) *counter {
+	return &counter{
+		name: name,
+		hits: make(map[string]int64),
+	}
+}
+
+func (c *counter) add(key string, n int64) {
+	c.mut.Lock()
+	if _, ok := c.hits[key]; !ok {
+		c.keys = append(c.keys, key)
+	}
+	c.hits[key] += n
+	c.mut.Unlock()
+}
+
+func (c *counter) get(key string) int64 {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return c.hits[key]
+}
+
+func (c *counter) len() int {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	return len(c.keys)
+}
+
+// each calls fn with every key and its hits in order
+func (c *counter) each(fn func(key string, hits int64)) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for _, key := range c.keys {
+		fn(key, c.hits[key])
+	}
+}
+
+func (c *counter) write(buf *bytebufferpool.ByteBuffer) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if len(c.keys) == 0 {
+		return
+	}
+
+	_, _ = buf.WriteString(c.name)
+	_, _ = buf.WriteString(":\n  ")
+	for i, key := range c.keys {
+		if i > 0 {
+			_, _ = buf.WriteString(", ")
+		}
+		_, _ = buf.WriteString(key)
+		_, _ = buf.WriteString(" - ")
+		buf.B = fasthttp.AppendUint(buf.B, int(c.hits[key]))
+	}
+	_ = buf.WriteByte('\n')
+}
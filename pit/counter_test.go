@@ -0,0 +1,26 @@
+package pit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_counter(t *testing.T) {
+	t.Parallel()
+
+	c := newCounter("name")
+	c.add("b", 1)
+	c.add("a", 2)
+	c.add("b", 3)
+
+	assert.Equal(t, 2, c.len())
+	assert.Equal(t, int64(4), c.get("b"))
+	assert.Equal(t, int64(0), c.get("c"))
+
+	var keys []string
+	c.each(func(key string, _ int64) {
+		keys = append(keys, key)
+	})
+	assert.Equal(t, []string{"b", "a"}, keys)
+}
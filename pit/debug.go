@@ -0,0 +1,579 @@
+package pit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	lg "github.com/charmbracelet/lipgloss"
+	"github.com/valyala/fasthttp"
+)
+
+// maxDebugBinary limits bytes of a binary body shown in debug mode
+const maxDebugBinary = 64
+
+var (
+	debugTitleStyle  = lg.NewStyle().Bold(true)
+	debugNameStyle   = lg.NewStyle().Foreground(lg.Color("6"))
+	debugKeyStyle    = lg.NewStyle().Foreground(lg.Color("4"))
+	debugStringStyle = lg.NewStyle().Foreground(lg.Color("2"))
+	debugValueStyle  = lg.NewStyle().Foreground(lg.Color("3"))
+	debugTagStyle    = lg.NewStyle().Foreground(lg.Color("4"))
+	debugFaintStyle  = lg.NewStyle().Faint(true)
+	debugCodeStyles  = map[byte]lg.Style{
+		'2': lg.NewStyle().Foreground(lg.Color("2")),
+		'3': lg.NewStyle().Foreground(lg.Color("6")),
+		'4': lg.NewStyle().Foreground(lg.Color("3")),
+		'5': lg.NewStyle().Foreground(lg.Color("1")),
+	}
+)
+
+// debugTrace records timings of phases of a request in debug mode,
+// dns, connect and tls are zero if a connection is reused
+type debugTrace struct {
+	mut     sync.Mutex
+	dns     time.Duration
+	connect time.Duration
+	tls     time.Duration
+	start   time.Time
+	wrote   time.Time
+	written time.Time
+	read    time.Time
+	done    time.Time
+
+	tlsConf *tls.Config
+	// h2TlsConf is used by http2 transport instead of tlsConf
+	h2TlsConf *tls.Config
+	// insecure reports whether verification failure is ignored
+	insecure bool
+	roots    *x509.CertPool
+	// tlsState is of the latest tls connection, it's kept
+	// for requests over a reused connection
+	tlsState  *tls.ConnectionState
+	verifyErr error
+
+	timeout time.Duration
+	// lookup indicates host is resolved before dialing,
+	// it's false if dialer connects elsewhere
+	lookup bool
+}
+
+func newDebugTrace(c *Config) *debugTrace {
+	t := &debugTrace{
+		timeout: c.Timeout,
+		lookup: c.inmemory == nil && c.UnixSocket == "" && len(c.proxies) == 0 &&
+			len(c.resolves) == 0,
+	}
+
+	if !c.isTLS {
+		return t
+	}
+
+	// verify certificates by ourselves to show the chain even if the
+	// verification fails, with a clone so that the config is not changed
+	conf := c.tlsClientConf()
+	t.insecure, t.roots = conf.InsecureSkipVerify, conf.RootCAs
+	conf.InsecureSkipVerify = true
+	conf.VerifyConnection = t.verifyConnection
+
+	if c.Http2 {
+		// http2 client does tls handshake by itself with ALPN
+		t.h2TlsConf = conf
+	} else {
+		t.tlsConf = conf
+	}
+
+	return t
+}
+
+// verifyConnection records the tls connection state and the verification
+// result of the server certificate chain against roots in use
+func (t *debugTrace) verifyConnection(cs tls.ConnectionState) error {
+	err := errNoPeerCertificate
+	if len(cs.PeerCertificates) > 0 {
+		opts := x509.VerifyOptions{
+			DNSName:       cs.ServerName,
+			Roots:         t.roots,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err = cs.PeerCertificates[0].Verify(opts)
+	}
+
+	t.mut.Lock()
+	t.tlsState, t.verifyErr = &cs, err
+	t.mut.Unlock()
+
+	if t.insecure {
+		return nil
+	}
+	return err
+}
+
+var errNoPeerCertificate = errors.New("no certificate from server")
+
+// dialer wraps dial to record timings of dns lookup, connect and
+// tls handshake, and timings of reading and writing of the connection
+func (t *debugTrace) dialer(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if t.lookup && err == nil && net.ParseIP(host) == nil {
+			start := time.Now()
+			ips, err := net.DefaultResolver.LookupIPAddr(context.Background(), host)
+			if err != nil {
+				return nil, err
+			}
+			t.set(&t.dns, time.Since(start))
+			addr = net.JoinHostPort(ips[0].IP.String(), port)
+		}
+
+		start := time.Now()
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		t.set(&t.connect, time.Since(start))
+
+		if t.tlsConf != nil {
+			start = time.Now()
+			tc := tls.Client(conn, t.tlsConf)
+			if t.timeout > 0 {
+				_ = tc.SetDeadline(start.Add(t.timeout))
+			}
+			if err = tc.Handshake(); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+			_ = tc.SetDeadline(time.Time{})
+			t.set(&t.tls, time.Since(start))
+			conn = tc
+		}
+
+		return &debugConn{Conn: conn, t: t}, nil
+	}
+}
+
+func (t *debugTrace) set(d *time.Duration, v time.Duration) {
+	t.mut.Lock()
+	*d = v
+	t.mut.Unlock()
+}
+
+// reset starts tracing a new request
+func (t *debugTrace) reset() {
+	if t == nil {
+		return
+	}
+
+	t.mut.Lock()
+	t.dns, t.connect, t.tls = 0, 0, 0
+	t.start, t.done = time.Now(), time.Time{}
+	t.wrote, t.written, t.read = time.Time{}, time.Time{}, time.Time{}
+	t.mut.Unlock()
+}
+
+// finish ends tracing the request
+func (t *debugTrace) finish() time.Duration {
+	if t == nil {
+		return 0
+	}
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	t.done = time.Now()
+	return t.done.Sub(t.start)
+}
+
+// debugConn records when a request is written and when
+// the first byte of response is read
+type debugConn struct {
+	net.Conn
+	t *debugTrace
+}
+
+func (c *debugConn) Write(b []byte) (int, error) {
+	c.t.mut.Lock()
+	if c.t.wrote.IsZero() {
+		c.t.wrote = time.Now()
+	}
+	c.t.mut.Unlock()
+
+	n, err := c.Conn.Write(b)
+
+	c.t.mut.Lock()
+	c.t.written = time.Now()
+	c.t.mut.Unlock()
+
+	return n, err
+}
+
+func (c *debugConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	c.t.mut.Lock()
+	if n > 0 && c.t.read.IsZero() {
+		c.t.read = time.Now()
+	}
+	c.t.mut.Unlock()
+
+	return n, err
+}
+
+// Handshake makes fasthttp treat the connection as a tls connection
+// which has been handshaked
+func (c *debugConn) Handshake() error {
+	return nil
+}
+
+// write writes timings of phases
+func (t *debugTrace) write(w io.Writer) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if t.done.IsZero() {
+		return
+	}
+
+	type phase struct {
+		name string
+		d    time.Duration
+	}
+	phases := []phase{{"DNS lookup", t.dns}, {"TCP connection", t.connect}, {"TLS handshake", t.tls}}
+	if !t.wrote.IsZero() && !t.read.IsZero() {
+		phases = append(phases,
+			phase{"Request sent", t.written.Sub(t.wrote)},
+			phase{"Waiting (TTFB)", t.read.Sub(t.written)},
+			phase{"Content download", t.done.Sub(t.read)},
+		)
+	}
+	phases = append(phases, phase{"Total", t.done.Sub(t.start)})
+
+	_, _ = io.WriteString(w, debugTitleStyle.Render("Timings:")+"\n")
+	for _, p := range phases {
+		if p.d <= 0 && p.name != "Total" {
+			continue
+		}
+		writeDebugField(w, "  ", 17, p.name, formatDebugLatency(p.d))
+	}
+}
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// writeTLS writes the negotiated parameters of tls and
+// the server certificate chain
+func (t *debugTrace) writeTLS(w io.Writer) {
+	if t == nil {
+		return
+	}
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	cs := t.tlsState
+	if cs == nil {
+		return
+	}
+	defer func() { _, _ = io.WriteString(w, "\n") }()
+
+	version, ok := tlsVersions[cs.Version]
+	if !ok {
+		version = fmt.Sprintf("0x%04x", cs.Version)
+	}
+	alpn := cs.NegotiatedProtocol
+	if alpn == "" {
+		alpn = "none"
+	}
+	roots := "system roots"
+	if t.roots != nil {
+		roots = "custom roots"
+	}
+	verification := debugCodeStyles['2'].Render("ok") + " (" + roots + ")"
+	if t.verifyErr != nil {
+		verification = debugCodeStyles['5'].Render("failed") + " (" + roots + "): " + t.verifyErr.Error()
+	}
+
+	_, _ = io.WriteString(w, debugTitleStyle.Render("TLS:")+"\n")
+	writeDebugField(w, "  ", 17, "Version", version)
+	writeDebugField(w, "  ", 17, "Cipher suite", tls.CipherSuiteName(cs.CipherSuite))
+	writeDebugField(w, "  ", 17, "ALPN protocol", alpn)
+	writeDebugField(w, "  ", 17, "Resumed", strconv.FormatBool(cs.DidResume))
+	writeDebugField(w, "  ", 17, "Verification", verification)
+
+	if len(cs.PeerCertificates) == 0 {
+		return
+	}
+
+	_, _ = io.WriteString(w, debugTitleStyle.Render("Certificates:")+"\n")
+	now := time.Now()
+	for i, cert := range cs.PeerCertificates {
+		writeDebugField(w, fmt.Sprintf("  %d. ", i), 7, "Subject", cert.Subject.String())
+		if sans := certSANs(cert); len(sans) > 0 {
+			writeDebugField(w, "     ", 7, "SANs", strings.Join(sans, ", "))
+		}
+		writeDebugField(w, "     ", 7, "Issuer", cert.Issuer.String())
+
+		expiry := cert.NotAfter.UTC().Format("2006-01-02 15:04:05 MST")
+		if left := cert.NotAfter.Sub(now); left > 0 {
+			expiry += fmt.Sprintf(" (%d days left)", int(left.Hours()/24))
+		} else {
+			expiry += " " + debugCodeStyles['5'].Render("(expired)")
+		}
+		writeDebugField(w, "     ", 7, "Expires", expiry)
+	}
+}
+
+// writeDebugField writes a line of a name aligned in width and its value
+func writeDebugField(w io.Writer, prefix string, width int, name, value string) {
+	_, _ = fmt.Fprintf(w, "%s%s %s\n", prefix, debugNameStyle.Render(fmt.Sprintf("%-*s", width, name)), value)
+}
+
+// certSANs returns DNS names, IPs, emails and URIs of a certificate
+func certSANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+func formatDebugLatency(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 2, 64) + "ms"
+}
+
+// writeHop writes a hop of redirect chain
+func writeHop(w io.Writer, i int, req *fasthttp.Request, resp *fasthttp.Response, latency time.Duration) {
+	if i == 1 {
+		_, _ = io.WriteString(w, debugTitleStyle.Render("Redirects:")+"\n")
+	}
+	_, _ = fmt.Fprintf(w, "  %d. %s %s %s -> %s (%s)\n", i, styleStatusCode(resp.StatusCode()),
+		req.Header.Method(), req.URI().FullURI(), resp.Header.Peek(fasthttp.HeaderLocation), formatDebugLatency(latency))
+}
+
+func styleStatusCode(code int) string {
+	s := strconv.Itoa(code)
+	if style, ok := debugCodeStyles[s[0]]; ok {
+		return style.Render(s)
+	}
+	return s
+}
+
+// writeHeader writes the start line and headers
+func writeHeader(w io.Writer, header []byte) {
+	lines := strings.Split(strings.TrimRight(string(header), "\r\n"), "\r\n")
+	for i, line := range lines {
+		if i == 0 {
+			_, _ = io.WriteString(w, debugTitleStyle.Render(line)+"\n")
+			continue
+		}
+		if j := strings.IndexByte(line, ':'); j > 0 {
+			line = debugNameStyle.Render(line[:j]) + line[j:]
+		}
+		_, _ = io.WriteString(w, line+"\n")
+	}
+}
+
+// writeBody writes a pretty and highlighted body if it's JSON or XML,
+// a binary body is truncated
+func writeBody(w io.Writer, body []byte, contentType string) {
+	if len(body) == 0 {
+		return
+	}
+
+	_, _ = io.WriteString(w, "\n")
+
+	switch {
+	case isBinary(body):
+		n := len(body)
+		if n > maxDebugBinary {
+			body = body[:maxDebugBinary]
+		}
+		_, _ = io.WriteString(w, hex.Dump(body))
+		_, _ = io.WriteString(w, debugFaintStyle.Render(fmt.Sprintf("binary body, %d bytes", n))+"\n")
+	case isJSON(body, contentType):
+		var buf bytes.Buffer
+		if json.Indent(&buf, body, "", "  ") == nil {
+			_, _ = io.WriteString(w, highlightJSON(buf.Bytes())+"\n")
+			return
+		}
+		_, _ = w.Write(body)
+		_, _ = io.WriteString(w, "\n")
+	case isXML(body, contentType):
+		if s, ok := prettyXML(body); ok {
+			_, _ = io.WriteString(w, s+"\n")
+			return
+		}
+		_, _ = w.Write(body)
+		_, _ = io.WriteString(w, "\n")
+	default:
+		_, _ = w.Write(body)
+		if body[len(body)-1] != '\n' {
+			_, _ = io.WriteString(w, "\n")
+		}
+	}
+}
+
+// isBinary reports whether body is not valid utf8 or has control characters
+func isBinary(body []byte) bool {
+	if !utf8.Valid(body) {
+		return true
+	}
+	for _, b := range body {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' {
+			return true
+		}
+	}
+	return false
+}
+
+func isJSON(body []byte, contentType string) bool {
+	if strings.Contains(contentType, "json") {
+		return true
+	}
+	b := bytes.TrimSpace(body)
+	return contentType == "" && len(b) > 0 && (b[0] == '{' || b[0] == '[') && json.Valid(b)
+}
+
+func isXML(body []byte, contentType string) bool {
+	return strings.Contains(contentType, "xml") || bytes.HasPrefix(bytes.TrimSpace(body), []byte("<?xml"))
+}
+
+// highlightJSON highlights keys, strings and other values of an indented JSON
+func highlightJSON(b []byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(b); {
+		switch c := b[i]; {
+		case c == '"':
+			j := i + 1
+			for ; j < len(b) && b[j] != '"'; j++ {
+				if b[j] == '\\' {
+					j++
+				}
+			}
+			j++
+			if j > len(b) {
+				j = len(b)
+			}
+			style := debugStringStyle
+			if k := j; k < len(b) && b[k] == ':' {
+				style = debugKeyStyle
+			}
+			sb.WriteString(style.Render(string(b[i:j])))
+			i = j
+		case c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z':
+			j := i + 1
+			for ; j < len(b) && strings.IndexByte("{}[],: \n", b[j]) == -1; j++ {
+			}
+			sb.WriteString(debugValueStyle.Render(string(b[i:j])))
+			i = j
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// prettyXML indents and highlights XML, elements which only
+// have text are kept in a line
+func prettyXML(body []byte) (string, bool) {
+	var (
+		sb    strings.Builder
+		d     = xml.NewDecoder(bytes.NewReader(body))
+		depth int
+		// open indicates the last token is a start element or its text
+		open bool
+	)
+
+	indent := func() {
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(strings.Repeat("  ", depth))
+	}
+
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", false
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			indent()
+			var tag strings.Builder
+			tag.WriteString("<" + xmlName(tok.Name))
+			for _, attr := range tok.Attr {
+				tag.WriteString(" " + xmlName(attr.Name) + `="`)
+				_ = xml.EscapeText(&tag, []byte(attr.Value))
+				tag.WriteString(`"`)
+			}
+			tag.WriteString(">")
+			sb.WriteString(debugTagStyle.Render(tag.String()))
+			depth++
+			open = true
+		case xml.EndElement:
+			depth--
+			if !open {
+				indent()
+			}
+			sb.WriteString(debugTagStyle.Render("</" + xmlName(tok.Name) + ">"))
+			open = false
+		case xml.CharData:
+			text := bytes.TrimSpace(tok)
+			if len(text) == 0 {
+				continue
+			}
+			if !open {
+				indent()
+			}
+			_ = xml.EscapeText(&sb, text)
+		case xml.Comment:
+			indent()
+			sb.WriteString(debugFaintStyle.Render("<!--" + string(tok) + "-->"))
+			open = false
+		case xml.ProcInst:
+			indent()
+			sb.WriteString(debugFaintStyle.Render("<?" + tok.Target + " " + string(tok.Inst) + "?>"))
+		case xml.Directive:
+			indent()
+			sb.WriteString(debugFaintStyle.Render("<!" + string(tok) + ">"))
+		}
+	}
+
+	return sb.String(), sb.Len() > 0
+}
+
+func xmlName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
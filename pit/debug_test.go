@@ -0,0 +1,209 @@
+package pit
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_Debug_Redirects(t *testing.T) {
+	t.Parallel()
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		switch string(ctx.Path()) {
+		case "/a":
+			ctx.Redirect("/b", fasthttp.StatusFound)
+		case "/b":
+			ctx.Redirect("/c", fasthttp.StatusMovedPermanently)
+		case "/loop":
+			ctx.Redirect("/loop", fasthttp.StatusFound)
+		default:
+			ctx.SetContentType("application/json")
+			ctx.SetBodyString(`{"path":"/c","ok":true}`)
+		}
+	}
+
+	doOnce := func(url string, maxRedirects int) (string, error) {
+		p := New(Config{Url: url, Debug: true, Follow: true, MaxRedirects: maxRedirects})
+		p.c.inmemory = startServer(t, handler)
+		assert.Nil(t, p.init())
+
+		var buf bytes.Buffer
+		p.client.(*fasthttpClient).wc = defaultWriteCloser{Writer: &buf}
+		err := p.doOnce()
+		return stripANSI(buf.String()), err
+	}
+
+	t.Run("chain", func(t *testing.T) {
+		out, err := doOnce("http://localhost/a", 0)
+		assert.Nil(t, err)
+		assert.Regexp(t, `Redirects:\n`+
+			`  1\. 302 GET http://localhost/a -> http://localhost/b \(\d+\.\d{2}ms\)\n`+
+			`  2\. 301 GET http://localhost/b -> http://localhost/c \(\d+\.\d{2}ms\)\n\n`+
+			`Connected to`, out)
+		assert.Contains(t, out, "GET /c HTTP/1.1")
+		assert.Contains(t, out, "{\n  \"path\": \"/c\",\n  \"ok\": true\n}")
+		assert.Contains(t, out, "Timings:\n  TCP connection")
+		assert.Contains(t, out, "Waiting (TTFB)")
+		assert.Regexp(t, `Total +\d+\.\d{2}ms`, out)
+	})
+
+	t.Run("too many redirects", func(t *testing.T) {
+		_, err := doOnce("http://localhost/loop", 3)
+		assert.Equal(t, fasthttp.ErrTooManyRedirects, err)
+	})
+}
+
+func Test_Debug_TLS(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(ts.Close)
+
+	doOnce := func(insecure bool) (string, error) {
+		p := New(Config{Url: ts.URL, Debug: true, Insecure: insecure})
+		assert.Nil(t, p.init())
+
+		var buf bytes.Buffer
+		p.client.(*fasthttpClient).wc = defaultWriteCloser{Writer: &buf}
+		err := p.doOnce()
+		return stripANSI(buf.String()), err
+	}
+
+	t.Run("insecure", func(t *testing.T) {
+		out, err := doOnce(true)
+		assert.Nil(t, err)
+		assert.Regexp(t, `TLS:\n`+
+			`  Version           TLS 1\.[23]\n`+
+			`  Cipher suite      TLS_\w+\n`+
+			`  ALPN protocol     none\n`+
+			`  Resumed           false\n`+
+			`  Verification      failed \(system roots\): x509: .+\n`+
+			`Certificates:\n`+
+			`  0\. Subject O=Acme Co\n`+
+			`     SANs    .*127\.0\.0\.1.*\n`+
+			`     Issuer  O=Acme Co\n`+
+			`     Expires \d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} UTC \(\d+ days left\)\n\n`+
+			`GET / HTTP/1\.1\n`, out)
+		assert.Contains(t, out, "TLS handshake")
+	})
+
+	t.Run("http2", func(t *testing.T) {
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		ts.EnableHTTP2 = true
+		ts.StartTLS()
+		t.Cleanup(ts.Close)
+
+		p := New(Config{Url: ts.URL, Debug: true, Http2: true})
+		assert.Nil(t, p.init())
+		// the config is not changed by debug trace
+		assert.False(t, p.c.tlsConf.InsecureSkipVerify)
+		assert.Nil(t, p.c.tlsConf.VerifyConnection)
+
+		var buf bytes.Buffer
+		p.client.(*fasthttpClient).wc = defaultWriteCloser{Writer: &buf}
+		assert.NotNil(t, p.doOnce())
+		out := stripANSI(buf.String())
+		assert.Contains(t, out, "ALPN protocol     h2\n")
+		assert.Contains(t, out, "Verification      failed (system roots)")
+	})
+
+	t.Run("verification failed", func(t *testing.T) {
+		out, err := doOnce(false)
+		assert.NotNil(t, err)
+		assert.Contains(t, out, "Verification      failed (system roots)")
+		assert.Contains(t, out, "Certificates:\n  0. Subject O=Acme Co")
+	})
+}
+
+func Test_debugTrace_write(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	(&debugTrace{}).write(&buf)
+	assert.Equal(t, "", buf.String())
+
+	now := time.Now()
+	tr := &debugTrace{
+		dns:     time.Millisecond,
+		start:   now,
+		wrote:   now,
+		written: now.Add(time.Millisecond),
+		read:    now.Add(time.Millisecond * 3),
+		done:    now.Add(time.Millisecond * 4),
+	}
+	tr.write(&buf)
+	assert.Equal(t, "Timings:\n"+
+		"  DNS lookup        1.00ms\n"+
+		"  Request sent      1.00ms\n"+
+		"  Waiting (TTFB)    2.00ms\n"+
+		"  Content download  1.00ms\n"+
+		"  Total             4.00ms\n", stripANSI(buf.String()))
+}
+
+func Test_writeBody(t *testing.T) {
+	t.Parallel()
+
+	t.Run("binary", func(t *testing.T) {
+		var buf bytes.Buffer
+		writeBody(&buf, bytes.Repeat([]byte{0, 1, 2, 3}, 100), "application/octet-stream")
+		out := stripANSI(buf.String())
+		assert.Equal(t, maxDebugBinary/16, strings.Count(out, "|\n"))
+		assert.Contains(t, out, "binary body, 400 bytes")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		writeBody(&buf, []byte(`[1,"a",{"b":null}]`), "")
+		assert.Equal(t, "\n[\n  1,\n  \"a\",\n  {\n    \"b\": null\n  }\n]\n", stripANSI(buf.String()))
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		var buf bytes.Buffer
+		writeBody(&buf, []byte(`{"a":`), "application/json")
+		assert.Equal(t, "\n{\"a\":\n", buf.String())
+	})
+
+	t.Run("xml", func(t *testing.T) {
+		var buf bytes.Buffer
+		writeBody(&buf, []byte(`<?xml version="1.0"?><a x="1"><b>text</b><!--c--><d><e/></d></a>`), "")
+		assert.Equal(t, "\n"+`<?xml version="1.0"?>
+<a x="1">
+  <b>text</b>
+  <!--c-->
+  <d>
+    <e></e>
+  </d>
+</a>`+"\n", stripANSI(buf.String()))
+	})
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		writeBody(&buf, []byte("hello"), "text/plain")
+		writeBody(&buf, nil, "text/plain")
+		assert.Equal(t, "\nhello\n", buf.String())
+	})
+}
+
+func Test_isBinary(t *testing.T) {
+	t.Parallel()
+
+	assert.False(t, isBinary([]byte("text\r\n\tline")))
+	assert.True(t, isBinary([]byte{0xff, 0xfe}))
+	assert.True(t, isBinary([]byte("a\x00b")))
+}
+
+var ansiRegexp = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func stripANSI(s string) string {
+	return ansiRegexp.ReplaceAllString(s, "")
+}
@@ -2,15 +2,17 @@ package pit
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"net"
 	"net/url"
-	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
 	"golang.org/x/net/proxy"
 )
 
@@ -57,80 +59,252 @@ var fasthttpDialer = func(throughput *int64, timeout time.Duration) func(string)
 	}
 }
 
-func fasthttpHttpProxyDialer(throughput *int64, proxy string, timeout time.Duration) fasthttp.DialFunc {
-	var auth string
-	if strings.Contains(proxy, "@") {
-		split := strings.Split(proxy, "@")
-		auth = base64.StdEncoding.EncodeToString([]byte(split[0]))
-		proxy = split[1]
+// fasthttpLocalAddrDialer binds connections to local ips in round-robin,
+// connections and bind failures are recorded by local ip
+func fasthttpLocalAddrDialer(throughput *int64, localIPs []net.IP, timeout time.Duration, localAddrs *group) fasthttp.DialFunc {
+	var next uint32
+	dialers := make([]*net.Dialer, len(localIPs))
+	for i, ip := range localIPs {
+		dialers[i] = &net.Dialer{
+			Timeout:   timeout,
+			LocalAddr: &net.TCPAddr{IP: ip},
+		}
 	}
 
-	return func(addr string) (net.Conn, error) {
-		var conn net.Conn
-		var err error
-		if timeout == 0 {
-			conn, err = fasthttp.Dial(proxy)
-		} else {
-			conn, err = fasthttp.DialTimeout(proxy, timeout)
+	return func(address string) (net.Conn, error) {
+		i := int(atomic.AddUint32(&next, 1)-1) % len(dialers)
+
+		start := time.Now()
+		conn, err := dialers[i].Dial("tcp", address)
+		if localAddrs != nil {
+			localAddrs.add(localIPs[i].String(), time.Since(start), err)
 		}
 		if err != nil {
-			return nil, fmt.Errorf("http proxy: %w", err)
+			return nil, err
 		}
 
-		req := "CONNECT " + addr + " HTTP/1.1\r\n"
-		if auth != "" {
-			req += "Proxy-Authorization: Basic " + auth + "\r\n"
+		return &counterConn{
+			Conn: conn,
+			n:    throughput,
+		}, nil
+	}
+}
+
+// fasthttpUnixDialer always connects to the unix domain socket
+// regardless of the address
+func fasthttpUnixDialer(throughput *int64, socket string, timeout time.Duration) fasthttp.DialFunc {
+	return func(_ string) (net.Conn, error) {
+		conn, err := net.DialTimeout("unix", socket, timeout)
+		if err != nil {
+			return nil, err
 		}
-		req += "\r\n"
 
-		if _, err = conn.Write([]byte(req)); err != nil {
+		return &counterConn{
+			Conn: conn,
+			n:    throughput,
+		}, nil
+	}
+}
+
+// fasthttpInmemoryDialer dials an in-memory listener instead of the network
+func fasthttpInmemoryDialer(throughput *int64, ln *fasthttputil.InmemoryListener) fasthttp.DialFunc {
+	return func(_ string) (net.Conn, error) {
+		conn, err := ln.Dial()
+		if err != nil {
+			return nil, err
+		}
+
+		return &counterConn{
+			Conn: conn,
+			n:    throughput,
+		}, nil
+	}
+}
+
+// fasthttpHttpProxyDialer connects to addresses by CONNECT of an http
+// proxy like [http://|https://][user:pass@]host:port, connections to
+// https proxies are over tls
+func fasthttpHttpProxyDialer(throughput *int64, proxy string, timeout time.Duration, insecure bool) fasthttp.DialFunc {
+	u, err := parseProxy(proxy, "http")
+	if err != nil {
+		return func(string) (net.Conn, error) {
 			return nil, fmt.Errorf("http proxy: %w", err)
 		}
+	}
+
+	var auth string
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+	}
+
+	isTLS := u.Scheme == "https"
+	proxyAddr := addMissingPort(u.Host, isTLS)
+	var tlsConf *tls.Config
+	if isTLS {
+		/* #nosec G402 */
+		tlsConf = &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: insecure}
+	}
 
-		res := fasthttp.AcquireResponse()
-		defer fasthttp.ReleaseResponse(res)
+	return func(addr string) (net.Conn, error) {
+		conn, err := dialProxy(proxyAddr, tlsConf, timeout, func(conn net.Conn) error {
+			req := "CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n"
+			if auth != "" {
+				req += "Proxy-Authorization: Basic " + auth + "\r\n"
+			}
+			req += "\r\n"
 
-		res.SkipBody = true
+			if _, err := conn.Write([]byte(req)); err != nil {
+				return err
+			}
 
-		if err = res.Read(bufio.NewReader(conn)); err != nil {
-			_ = conn.Close()
+			res := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseResponse(res)
+
+			res.SkipBody = true
+
+			if err := res.Read(bufio.NewReader(conn)); err != nil {
+				return err
+			}
+			if res.Header.StatusCode() != fasthttp.StatusOK {
+				return fmt.Errorf("could not connect to proxy, status code %d", res.Header.StatusCode())
+			}
+			return nil
+		})
+		if err != nil {
 			return nil, fmt.Errorf("http proxy: %w", err)
 		}
-		if res.Header.StatusCode() != 200 {
-			_ = conn.Close()
-			return nil, fmt.Errorf("could not connect to proxy")
-		}
 
-		cc := &counterConn{
+		return &counterConn{
 			Conn: conn,
 			n:    throughput,
-		}
+		}, nil
+	}
+}
 
-		return cc, nil
+// dialProxy dials a proxy and connects through it by connect
+// within timeout, the connection is closed if it fails
+func dialProxy(proxyAddr string, tlsConf *tls.Config, timeout time.Duration, connect func(net.Conn) error) (conn net.Conn, err error) {
+	if timeout == 0 {
+		conn, err = fasthttp.Dial(proxyAddr)
+	} else {
+		conn, err = fasthttp.DialTimeout(proxyAddr, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+	}
+	if tlsConf != nil {
+		tc := tls.Client(conn, tlsConf)
+		if err = tc.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tc
 	}
+	if err = connect(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	return conn, nil
 }
 
-func fasthttpSocksProxyDialer(throughput *int64, proxyAddr string) fasthttp.DialFunc {
+// fasthttpSocksProxyDialer connects to addresses through a socks proxy,
+// dialing and the socks handshake are done within timeout
+func fasthttpSocksProxyDialer(throughput *int64, proxyAddr string, timeout time.Duration) fasthttp.DialFunc {
 	var (
 		u      *url.URL
 		err    error
 		dialer proxy.Dialer
 	)
 
-	if u, err = url.Parse(proxyAddr); err == nil {
-		dialer, err = proxy.FromURL(u, proxy.Direct)
+	if u, err = parseProxy(proxyAddr, "socks5"); err == nil {
+		if dialer, err = proxy.FromURL(u, &net.Dialer{Timeout: timeout}); err == nil {
+			if _, ok := dialer.(proxy.ContextDialer); !ok {
+				err = fmt.Errorf("unsupported proxy %s", u.Redacted())
+			}
+		}
 	}
 
 	return func(addr string) (net.Conn, error) {
 		if err != nil {
 			return nil, fmt.Errorf("socks proxy: %w", err)
 		}
-		var conn net.Conn
-		conn, err = dialer.Dial("tcp", addr)
+
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		conn, err := dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("socks proxy: %w", err)
+		}
 
 		return &counterConn{
 			Conn: conn,
 			n:    throughput,
-		}, err
+		}, nil
+	}
+}
+
+// idleTimeoutConn sets read deadline before every read, so that a long
+// response fails only if no data arrives within timeout
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (ic *idleTimeoutConn) Read(b []byte) (n int, err error) {
+	if err = ic.Conn.SetReadDeadline(time.Now().Add(ic.timeout)); err != nil {
+		return
+	}
+
+	return ic.Conn.Read(b)
+}
+
+func idleTimeoutDialer(dial fasthttp.DialFunc, timeout time.Duration) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil || timeout <= 0 {
+			return conn, err
+		}
+
+		return &idleTimeoutConn{
+			Conn:    conn,
+			timeout: timeout,
+		}, nil
+	}
+}
+
+// resolveDialer dials overridden addresses of host and port in round-robin,
+// dial errors are recorded by address
+func resolveDialer(dial fasthttp.DialFunc, resolves map[string][]string, remoteAddrs *group) fasthttp.DialFunc {
+	var next uint32
+	return func(hostPort string) (net.Conn, error) {
+		addrs, ok := resolves[hostPort]
+		if !ok {
+			return dial(hostPort)
+		}
+
+		_, port, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			return nil, err
+		}
+
+		addr := addrs[int(atomic.AddUint32(&next, 1)-1)%len(addrs)]
+		conn, err := dial(net.JoinHostPort(addr, port))
+		if err != nil && remoteAddrs != nil {
+			remoteAddrs.add(addr, 0, err)
+		}
+
+		return conn, err
 	}
 }
@@ -1,8 +1,11 @@
 package pit
 
 import (
+	"errors"
 	"net"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -60,6 +63,76 @@ func Test_fasthttpDialer(t *testing.T) {
 	})
 }
 
+func Test_fasthttpLocalAddrDialer(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer func() { _ = ln.Close() }()
+
+	go func() {
+		_ = fasthttp.Serve(ln, func(_ *fasthttp.RequestCtx) {})
+	}()
+
+	var throughput int64
+	localAddrs := newGroup("Local addresses", "conns")
+	dial := fasthttpLocalAddrDialer(&throughput, []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}, time.Second, localAddrs)
+
+	conn, err := dial(ln.Addr().String())
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1", remoteIP(conn.LocalAddr()))
+	_ = conn.Close()
+
+	// ipv6 local address can't connect to ipv4 address
+	_, err = dial(ln.Addr().String())
+	assert.NotNil(t, err)
+
+	assert.Equal(t, int64(1), localAddrs.get("127.0.0.1").reqs)
+	assert.Equal(t, int64(1), localAddrs.get("::1").errs)
+}
+
+func Test_fasthttpUnixDialer(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("skip windows test")
+	}
+
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := net.Listen("unix", socket)
+	assert.Nil(t, err)
+
+	go func() {
+		_ = fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+			_, _ = ctx.Write(ctx.Host())
+			_, _ = ctx.Write(ctx.Path())
+		})
+	}()
+	defer func() { _ = ln.Close() }()
+
+	var throughput int64
+
+	t.Run("error", func(t *testing.T) {
+		_, err := fasthttpUnixDialer(&throughput, socket+".not-exist", time.Second)("example.com:80")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		hc := &fasthttp.HostClient{
+			Addr: "example.com:80",
+			Dial: fasthttpUnixDialer(&throughput, socket, time.Second),
+		}
+
+		req := &fasthttp.Request{}
+		req.SetRequestURI("http://example.com/foo")
+		resp := &fasthttp.Response{}
+
+		assert.Nil(t, hc.Do(req, resp))
+		assert.Equal(t, "example.com/foo", string(resp.Body()))
+		assert.True(t, throughput > 0)
+	})
+}
+
 func Test_fasthttpHttpProxyDialer(t *testing.T) {
 	t.Parallel()
 
@@ -80,7 +153,7 @@ func Test_fasthttpHttpProxyDialer(t *testing.T) {
 		}
 		hc := &fasthttp.HostClient{
 			Addr: addr,
-			Dial: fasthttpHttpProxyDialer(&throughput, addr, time.Nanosecond),
+			Dial: fasthttpHttpProxyDialer(&throughput, addr, time.Nanosecond, false),
 		}
 
 		req := &fasthttp.Request{}
@@ -96,7 +169,7 @@ func Test_fasthttpHttpProxyDialer(t *testing.T) {
 	t.Run("0 timeout", func(t *testing.T) {
 		hc := &fasthttp.HostClient{
 			Addr: addr,
-			Dial: fasthttpHttpProxyDialer(&throughput, addr, 0),
+			Dial: fasthttpHttpProxyDialer(&throughput, addr, 0, false),
 		}
 
 		req := &fasthttp.Request{}
@@ -111,7 +184,7 @@ func Test_fasthttpHttpProxyDialer(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		hc := &fasthttp.HostClient{
 			Addr: addr,
-			Dial: fasthttpHttpProxyDialer(&throughput, "a:b@"+addr, time.Second*3),
+			Dial: fasthttpHttpProxyDialer(&throughput, "a:b@"+addr, time.Second*3, false),
 		}
 
 		req := &fasthttp.Request{}
@@ -141,7 +214,7 @@ func Test_fasthttpSocksProxyDialer(t *testing.T) {
 	t.Run("error proxy", func(t *testing.T) {
 		hc := &fasthttp.HostClient{
 			Addr: addr,
-			Dial: fasthttpSocksProxyDialer(&throughput, addr),
+			Dial: fasthttpSocksProxyDialer(&throughput, addr, time.Second),
 		}
 
 		req := &fasthttp.Request{}
@@ -157,7 +230,7 @@ func Test_fasthttpSocksProxyDialer(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		hc := &fasthttp.HostClient{
 			Addr: addr,
-			Dial: fasthttpSocksProxyDialer(&throughput, "socks5://127.0.0.1:88888"),
+			Dial: fasthttpSocksProxyDialer(&throughput, "socks5://127.0.0.1:88888", time.Second),
 		}
 
 		req := &fasthttp.Request{}
@@ -168,3 +241,54 @@ func Test_fasthttpSocksProxyDialer(t *testing.T) {
 		assert.NotNil(t, hc.Do(req, resp))
 	})
 }
+
+func Test_idleTimeoutDialer(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer func() { _ = ln.Close() }()
+
+	var throughput int64
+
+	t.Run("no timeout", func(t *testing.T) {
+		conn, err := idleTimeoutDialer(fasthttpDialer(&throughput, time.Second), 0)(ln.Addr().String())
+		assert.Nil(t, err)
+		assert.IsType(t, &counterConn{}, conn)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		conn, err := idleTimeoutDialer(fasthttpDialer(&throughput, time.Second), time.Millisecond*10)(ln.Addr().String())
+		assert.Nil(t, err)
+
+		_, err = conn.Read(make([]byte, 1))
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "timeout")
+	})
+}
+
+func Test_resolveDialer(t *testing.T) {
+	t.Parallel()
+
+	var dialed []string
+	dial := func(addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if strings.HasPrefix(addr, "2.2.2.2") {
+			return nil, errors.New("refused")
+		}
+		return nil, nil
+	}
+
+	remoteAddrs := newGroup("Remote addresses", "reqs")
+	d := resolveDialer(dial, map[string][]string{
+		"example.com:80": {"1.1.1.1", "2.2.2.2", "::1"},
+	}, remoteAddrs)
+
+	for i := 0; i < 4; i++ {
+		_, _ = d("example.com:80")
+	}
+	_, _ = d("other.com:80")
+
+	assert.Equal(t, []string{"1.1.1.1:80", "2.2.2.2:80", "[::1]:80", "1.1.1.1:80", "other.com:80"}, dialed)
+	assert.Equal(t, int64(1), remoteAddrs.get("2.2.2.2").errs)
+}
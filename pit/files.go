@@ -0,0 +1,67 @@
+package pit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// fileSystem reads files of bodies, request items, TLS, scripts and
+// scenarios. A nil fileSystem reads local files, otherwise only files
+// shipped by the coordinator can be read, so that agents never read
+// their own files on behalf of coordinators.
+type fileSystem struct {
+	// shipped are file contents by cleaned path
+	shipped map[string][]byte
+}
+
+func (fs *fileSystem) readFile(path string) ([]byte, error) {
+	path = filepath.Clean(path)
+	if fs == nil {
+		return ioutil.ReadFile(path)
+	}
+
+	b, ok := fs.shipped[path]
+	if !ok {
+		return nil, fmt.Errorf("open %s: file is not shipped by coordinator", path)
+	}
+	return b, nil
+}
+
+// stat reports an error if the file can't be read
+func (fs *fileSystem) stat(path string) error {
+	if fs == nil {
+		_, err := os.Stat(filepath.Clean(path))
+		return err
+	}
+
+	_, err := fs.readFile(path)
+	return err
+}
+
+// open opens the file as a stream with its size
+func (fs *fileSystem) open(path string) (io.ReadCloser, int, error) {
+	if fs != nil {
+		b, err := fs.readFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(b)), len(b), nil
+	}
+
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+
+	return f, int(fi.Size()), nil
+}
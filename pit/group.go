@@ -0,0 +1,126 @@
+package pit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
+)
+
+// group collects requests, errors and latencies by key concurrently,
+// it keeps keys in the order of their first appearance
+type group struct {
+	name  string
+	unit  string
+	mut   sync.Mutex
+	keys  []string
+	stats map[string]*groupStat
+}
+
+type groupStat struct {
+	reqs       int64
+	errs       int64
+	latencySum time.Duration
+	latencyMax time.Duration
+}
+
+func newGroup(name, unit string) *group {
+	return &group{
+		name:  name,
+		unit:  unit,
+		stats: make(map[string]*groupStat),
+	}
+}
+
+// add records a request of key, it's counted as an error if err is not nil
+func (g *group) add(key string, latency time.Duration, err error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	s, ok := g.stats[key]
+	if !ok {
+		s = &groupStat{}
+		g.stats[key] = s
+		g.keys = append(g.keys, key)
+	}
+
+	if err != nil {
+		s.errs++
+		return
+	}
+
+	s.reqs++
+	s.latencySum += latency
+	if latency > s.latencyMax {
+		s.latencyMax = latency
+	}
+}
+
+// merge merges a stat of key
+func (g *group) merge(key string, gs groupStat) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	s, ok := g.stats[key]
+	if !ok {
+		s = &groupStat{}
+		g.stats[key] = s
+		g.keys = append(g.keys, key)
+	}
+
+	s.reqs += gs.reqs
+	s.errs += gs.errs
+	s.latencySum += gs.latencySum
+	if gs.latencyMax > s.latencyMax {
+		s.latencyMax = gs.latencyMax
+	}
+}
+
+// each calls fn with every key and its stat in order
+func (g *group) each(fn func(key string, gs groupStat)) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	for _, key := range g.keys {
+		fn(key, *g.stats[key])
+	}
+}
+
+func (g *group) get(key string) groupStat {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	if s, ok := g.stats[key]; ok {
+		return *s
+	}
+	return groupStat{}
+}
+
+func (g *group) write(buf *bytebufferpool.ByteBuffer) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	if len(g.keys) == 0 {
+		return
+	}
+
+	_, _ = buf.WriteString(g.name)
+	_, _ = buf.WriteString(":\n")
+	for _, key := range g.keys {
+		s := g.stats[key]
+		_, _ = buf.WriteString("  ")
+		_, _ = buf.WriteString(key)
+		_, _ = buf.WriteString(" - ")
+		_, _ = buf.WriteString(g.unit)
+		_ = buf.WriteByte(' ')
+		buf.B = fasthttp.AppendUint(buf.B, int(s.reqs))
+		_, _ = buf.WriteString(", errors ")
+		buf.B = fasthttp.AppendUint(buf.B, int(s.errs))
+		_, _ = buf.WriteString(", latency avg ")
+		writeMs(buf, avgDuration(s.latencySum, s.reqs))
+		_, _ = buf.WriteString(" max ")
+		writeMs(buf, s.latencyMax)
+		_ = buf.WriteByte('\n')
+	}
+}
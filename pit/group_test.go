@@ -0,0 +1,35 @@
+package pit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/bytebufferpool"
+)
+
+func Test_group(t *testing.T) {
+	t.Parallel()
+
+	g := newGroup("Group", "reqs")
+
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	g.write(buf)
+	assert.Equal(t, "", buf.String())
+
+	g.add("b", time.Millisecond, nil)
+	g.add("b", time.Millisecond*3, nil)
+	g.add("a", 0, errors.New("error"))
+
+	assert.Equal(t, groupStat{reqs: 2, latencySum: time.Millisecond * 4, latencyMax: time.Millisecond * 3}, g.get("b"))
+	assert.Equal(t, groupStat{errs: 1}, g.get("a"))
+	assert.Equal(t, groupStat{}, g.get("c"))
+
+	g.write(buf)
+	assert.Equal(t, "Group:\n"+
+		"  b - reqs 2, errors 0, latency avg 2.00ms max 3.00ms\n"+
+		"  a - reqs 0, errors 1, latency avg 0.00ms max 0.00ms\n", buf.String())
+}
@@ -0,0 +1,373 @@
+package pit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const MIMEApplicationGrpc = "application/grpc"
+
+// grpcStatusNames maps grpc-status codes to their names
+var grpcStatusNames = [...]string{
+	"OK", "Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded",
+	"NotFound", "AlreadyExists", "PermissionDenied", "ResourceExhausted",
+	"FailedPrecondition", "Aborted", "OutOfRange", "Unimplemented",
+	"Internal", "Unavailable", "DataLoss", "Unauthenticated",
+}
+
+func grpcStatusName(status string) string {
+	if status == "" {
+		return "Missing"
+	}
+	if code, err := strconv.Atoi(status); err == nil && code >= 0 && code < len(grpcStatusNames) {
+		return grpcStatusNames[code]
+	}
+	return status
+}
+
+// grpcClient sends unary gRPC requests over http/2
+type grpcClient struct {
+	transports []*http2.Transport
+	next       uint32
+	url        string
+	host       string
+	header     http.Header
+	oauth2     *oauth2Source
+	message    []byte
+	timeout    time.Duration
+	method     protoreflect.MethodDescriptor
+	statuses   *counter
+	wc         io.WriteCloser
+}
+
+func newGrpcClient(c *Config) (gc *grpcClient, err error) {
+	gc = &grpcClient{
+		url:     c.Url,
+		host:    c.Host,
+		header:  make(http.Header),
+		timeout: c.Timeout,
+		wc:      defaultWriteCloser{Writer: os.Stdout},
+	}
+
+	u, err := url.Parse(c.Url)
+	if err != nil {
+		return
+	}
+
+	switch u.Scheme {
+	case "https":
+		c.isTLS = true
+	case "http":
+	default:
+		err = fmt.Errorf("unsupported protocol %q. http and https are supported", u.Scheme)
+		return
+	}
+	c.addr = addMissingPort(u.Host, c.isTLS)
+
+	if err = c.checkAuth(); err != nil {
+		return
+	}
+	if c.Signer != nil || c.HmacKey != "" || c.AwsSigV4 != "" {
+		err = errors.New("request signing is not supported with gRPC")
+		return
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		c.setUserinfo(u.User.Username(), password)
+		u.User = nil
+		gc.url = u.String()
+	}
+
+	if c.ProtoSet != "" {
+		if gc.method, err = findGrpcMethod(c.fs, c.ProtoSet, u.Path); err != nil {
+			return
+		}
+	}
+
+	if err = c.readBody(); err != nil {
+		return
+	}
+	if gc.message, err = gc.encode(c.body); err != nil {
+		return
+	}
+
+	kvs, err := headers(c.Headers).kvs()
+	if err != nil {
+		return
+	}
+	for i := 0; i < len(kvs); i += 2 {
+		gc.header.Add(kvs[i], kvs[i+1])
+	}
+	gc.header.Set("Content-Type", MIMEApplicationGrpc)
+	gc.header.Set("TE", "trailers")
+	gc.header.Set("User-Agent", "httpit/"+Version)
+	if v := c.authorization(); v != "" {
+		gc.header.Set(headerAuthorization, v)
+	}
+
+	if c.tlsConf, err = c.getTlsConfig(); err != nil {
+		return
+	}
+
+	if gc.oauth2, err = c.getOAuth2Source(); err != nil {
+		return
+	}
+
+	n := c.Connections
+	if n <= 0 || c.Debug {
+		n = 1
+	}
+	dial := c.getDialer()
+	gc.transports = make([]*http2.Transport, n)
+	for i := range gc.transports {
+		gc.transports[i] = &http2.Transport{
+			AllowHTTP:       !c.isTLS,
+			TLSClientConfig: c.tlsConf,
+			DialTLS:         grpcDialer(dial, c.isTLS),
+		}
+	}
+
+	gc.statuses = c.newCounter("gRPC codes")
+
+	return
+}
+
+func grpcDialer(dial func(string) (net.Conn, error), isTLS bool) func(string, string, *tls.Config) (net.Conn, error) {
+	return func(_, addr string, conf *tls.Config) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil || !isTLS {
+			return conn, err
+		}
+
+		tlsConn := tls.Client(conn, conf)
+		if err = tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		return tlsConn, nil
+	}
+}
+
+// encode builds a length-prefixed gRPC message from request body
+func (c *grpcClient) encode(body []byte) ([]byte, error) {
+	if c.method != nil {
+		msg := dynamicpb.NewMessage(c.method.Input())
+		if len(body) > 0 {
+			if err := protojson.Unmarshal(body, msg); err != nil {
+				return nil, fmt.Errorf("failed to parse gRPC request: %w", err)
+			}
+		}
+		var err error
+		if body, err = proto.Marshal(msg); err != nil {
+			return nil, err
+		}
+	}
+
+	frame := make([]byte, 5+len(body))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(body)))
+	copy(frame[5:], body)
+
+	return frame, nil
+}
+
+// decode returns the first message of a gRPC response body
+func (c *grpcClient) decode(body []byte) (msg []byte, err error) {
+	if len(body) == 0 {
+		return
+	}
+	if len(body) < 5 {
+		return nil, errors.New("malformed gRPC message")
+	}
+	if body[0] != 0 {
+		return nil, errors.New("compressed gRPC message is not supported")
+	}
+
+	n := binary.BigEndian.Uint32(body[1:5])
+	if int(n) > len(body)-5 {
+		return nil, errors.New("malformed gRPC message")
+	}
+	msg = body[5 : 5+n]
+
+	if c.method != nil {
+		m := dynamicpb.NewMessage(c.method.Output())
+		if err = proto.Unmarshal(msg, m); err != nil {
+			return
+		}
+		msg, err = protojson.MarshalOptions{Multiline: true}.Marshal(m)
+	}
+
+	return
+}
+
+func (c *grpcClient) transport() *http2.Transport {
+	i := atomic.AddUint32(&c.next, 1)
+	return c.transports[int(i)%len(c.transports)]
+}
+
+func (c *grpcClient) roundTrip(body *[]byte) (resp *http.Response, status string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(c.message))
+	if err != nil {
+		return
+	}
+	req.Header = c.header
+	if c.oauth2 != nil {
+		req.Header = c.header.Clone()
+		req.Header.Set(headerAuthorization, c.oauth2.authorization())
+	}
+	if c.host != "" {
+		req.Host = c.host
+	}
+
+	if resp, err = c.transport().RoundTrip(req); err != nil {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if body != nil {
+		*body, err = ioutil.ReadAll(resp.Body)
+	} else {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+	}
+	if err != nil {
+		return
+	}
+
+	// trailers-only response carries grpc-status in headers
+	if status = resp.Trailer.Get("grpc-status"); status == "" {
+		status = resp.Header.Get("grpc-status")
+	}
+
+	return
+}
+
+func (c *grpcClient) do() (code int, latency time.Duration, err error) {
+	start := time.Now()
+	resp, status, err := c.roundTrip(nil)
+	if err != nil {
+		return
+	}
+
+	code = resp.StatusCode
+	latency = time.Since(start)
+	c.statuses.add(grpcStatusName(status), 1)
+
+	return
+}
+
+func (c *grpcClient) doOnce() (err error) {
+	var body []byte
+	resp, status, err := c.roundTrip(&body)
+	if err != nil {
+		return
+	}
+
+	msg, err := c.decode(body)
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintf(&buf, "POST %s HTTP/2.0\r\n", c.url)
+	writeHttpHeader(&buf, c.header)
+	_, _ = fmt.Fprintf(&buf, "\r\n%d bytes message\r\n\n\n", len(c.message)-5)
+
+	_, _ = fmt.Fprintf(&buf, "%s %s\r\n", resp.Proto, resp.Status)
+	writeHttpHeader(&buf, resp.Header)
+	_, _ = buf.WriteString("\r\n")
+	_, _ = buf.Write(msg)
+	_, _ = buf.WriteString("\r\n\r\n")
+	writeHttpHeader(&buf, resp.Trailer)
+	_, _ = fmt.Fprintf(&buf, "\r\ngRPC status: %s\r\n", grpcStatusName(status))
+	if m := resp.Trailer.Get("grpc-message"); m != "" {
+		_, _ = fmt.Fprintf(&buf, "gRPC message: %s\r\n", m)
+	}
+
+	_, _ = c.wc.Write(buf.Bytes())
+	_ = c.wc.Close()
+
+	return
+}
+
+func writeHttpHeader(w io.Writer, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(w, "%s: %s\r\n", k, strings.Join(h[k], ", "))
+	}
+}
+
+// findGrpcMethod finds method descriptor like /package.Service/Method
+// from a FileDescriptorSet file
+func findGrpcMethod(fs *fileSystem, protoSet, path string) (protoreflect.MethodDescriptor, error) {
+	b, err := fs.readFile(protoSet)
+	if err != nil {
+		return nil, err
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err = proto.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", protoSet, err)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", protoSet, err)
+	}
+
+	name := strings.TrimPrefix(path, "/")
+	i := strings.LastIndex(name, "/")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid gRPC method path %q", path)
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name[:i]))
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found", name[:i])
+	}
+
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", name[:i])
+	}
+
+	md := sd.Methods().ByName(protoreflect.Name(name[i+1:]))
+	if md == nil {
+		return nil, fmt.Errorf("method %s not found in service %s", name[i+1:], name[:i])
+	}
+
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("%s is a streaming method, only unary method is supported", path)
+	}
+
+	return md, nil
+}
@@ -0,0 +1,254 @@
+package pit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func Test_grpcClient_New(t *testing.T) {
+	t.Parallel()
+
+	protoSet := writeEchoProtoSet(t)
+
+	t.Run("unsupported protocol", func(t *testing.T) {
+		_, err := newGrpcClient(&Config{Url: "ftp://host"})
+		assert.EqualError(t, err, `unsupported protocol "ftp". http and https are supported`)
+	})
+
+	t.Run("error header", func(t *testing.T) {
+		_, err := newGrpcClient(&Config{Url: "http://host", Headers: []string{"a"}})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("error proto set", func(t *testing.T) {
+		_, err := newGrpcClient(&Config{Url: "http://host/echo.Echo/Say", ProtoSet: "non-exist"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("error json body", func(t *testing.T) {
+		_, err := newGrpcClient(&Config{Url: "http://host/echo.Echo/Say", ProtoSet: protoSet, Body: "{"})
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "failed to parse gRPC request")
+	})
+
+	t.Run("https", func(t *testing.T) {
+		c := &Config{Url: "https://host/echo.Echo/Say", ProtoSet: protoSet, Body: `{"text":"hi"}`, Connections: 2}
+		gc, err := newGrpcClient(c)
+		assert.Nil(t, err)
+		assert.True(t, c.isTLS)
+		assert.Equal(t, "host:443", c.addr)
+		assert.Len(t, gc.transports, 2)
+		assert.Equal(t, []byte{0, 0, 0, 0, 4, 10, 2, 'h', 'i'}, gc.message)
+	})
+}
+
+func Test_findGrpcMethod(t *testing.T) {
+	t.Parallel()
+
+	protoSet := writeEchoProtoSet(t)
+
+	testCases := []struct {
+		path string
+		err  string
+	}{
+		{"/Say", `invalid gRPC method path "/Say"`},
+		{"/echo.Nope/Say", "service echo.Nope not found"},
+		{"/echo.Message/Say", "echo.Message is not a service"},
+		{"/echo.Echo/Nope", "method Nope not found in service echo.Echo"},
+		{"/echo.Echo/Stream", "/echo.Echo/Stream is a streaming method, only unary method is supported"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			_, err := findGrpcMethod(nil, protoSet, tc.path)
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+
+	t.Run("invalid file", func(t *testing.T) {
+		_, err := findGrpcMethod(nil, "testdata/ssl.pem", "/echo.Echo/Say")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		md, err := findGrpcMethod(nil, protoSet, "/echo.Echo/Say")
+		assert.Nil(t, err)
+		assert.Equal(t, "echo.Message", string(md.Input().FullName()))
+	})
+}
+
+func Test_grpcClient_Do(t *testing.T) {
+	t.Parallel()
+
+	addr := startGrpcServer(t)
+
+	t.Run("raw message", func(t *testing.T) {
+		c := &Config{Url: addr + "/echo.Echo/Say", Body: "\x0a\x02hi", Timeout: time.Second}
+		gc, err := newGrpcClient(c)
+		assert.Nil(t, err)
+
+		for i := 0; i < 3; i++ {
+			code, latency, err := gc.do()
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, code)
+			assert.True(t, latency > 0)
+		}
+		assert.Equal(t, int64(3), gc.statuses.get("OK"))
+		assert.True(t, c.throughput > 0)
+	})
+
+	t.Run("trailers only", func(t *testing.T) {
+		gc, err := newGrpcClient(&Config{Url: addr + "/echo.Echo/Nope", Timeout: time.Second})
+		assert.Nil(t, err)
+
+		code, _, err := gc.do()
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(1), gc.statuses.get("Unimplemented"))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		gc, err := newGrpcClient(&Config{Url: addr + "/echo.Echo/Slow", Timeout: time.Millisecond * 10})
+		assert.Nil(t, err)
+
+		_, _, err = gc.do()
+		assert.NotNil(t, err)
+	})
+}
+
+func Test_grpcClient_DoOnce(t *testing.T) {
+	t.Parallel()
+
+	addr := startGrpcServer(t)
+
+	gc, err := newGrpcClient(&Config{
+		Url:      addr + "/echo.Echo/Say",
+		ProtoSet: writeEchoProtoSet(t),
+		Body:     `{"text":"hello"}`,
+		Timeout:  time.Second,
+		Debug:    true,
+	})
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	gc.wc = defaultWriteCloser{Writer: &buf}
+	assert.Nil(t, gc.doOnce())
+
+	output := buf.String()
+	assert.Contains(t, output, "POST "+addr+"/echo.Echo/Say HTTP/2.0")
+	assert.Contains(t, output, `"hello"`)
+	assert.Contains(t, output, "gRPC status: OK")
+}
+
+func Test_grpcClient_decode(t *testing.T) {
+	t.Parallel()
+
+	gc := &grpcClient{}
+
+	testCases := []struct {
+		name string
+		body []byte
+		err  string
+	}{
+		{"short", []byte{0, 0}, "malformed gRPC message"},
+		{"compressed", []byte{1, 0, 0, 0, 0}, "compressed gRPC message is not supported"},
+		{"too long", []byte{0, 0, 0, 0, 9, 1}, "malformed gRPC message"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := gc.decode(tc.body)
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+
+	msg, err := gc.decode([]byte{0, 0, 0, 0, 1, 'a'})
+	assert.Nil(t, err)
+	assert.Equal(t, "a", string(msg))
+}
+
+func Test_grpcStatusName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "Missing", grpcStatusName(""))
+	assert.Equal(t, "OK", grpcStatusName("0"))
+	assert.Equal(t, "Unauthenticated", grpcStatusName("16"))
+	assert.Equal(t, "17", grpcStatusName("17"))
+}
+
+// startGrpcServer starts an in-process h2c gRPC server which echoes
+// the request message of /echo.Echo/Say
+func startGrpcServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MIMEApplicationGrpc)
+		switch r.URL.Path {
+		case "/echo.Echo/Say":
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Trailer", "Grpc-Status")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(body)
+			w.Header().Set("Grpc-Status", "0")
+		case "/echo.Echo/Slow":
+			time.Sleep(time.Millisecond * 100)
+		default:
+			w.Header().Set("Grpc-Status", "12")
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+
+	s := &http.Server{Handler: h2c.NewHandler(handler, &http2.Server{})}
+	go func() { _ = s.Serve(ln) }()
+	t.Cleanup(func() { _ = s.Close() })
+
+	return "http://" + ln.Addr().String()
+}
+
+func writeEchoProtoSet(t *testing.T) string {
+	message := ".echo.Message"
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("echo.proto"),
+			Package: proto.String("echo"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Message"),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:     proto.String("text"),
+					JsonName: proto.String("text"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				}},
+			}},
+			Service: []*descriptorpb.ServiceDescriptorProto{{
+				Name: proto.String("Echo"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{Name: proto.String("Say"), InputType: &message, OutputType: &message},
+					{Name: proto.String("Stream"), InputType: &message, OutputType: &message, ServerStreaming: proto.Bool(true)},
+				},
+			}},
+		}},
+	}
+
+	b, err := proto.Marshal(set)
+	assert.Nil(t, err)
+
+	path := filepath.Join(t.TempDir(), "echo.protoset")
+	assert.Nil(t, ioutil.WriteFile(path, b, 0600))
+
+	return path
+}
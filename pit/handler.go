@@ -0,0 +1,123 @@
+package pit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// RunHandler benchmarks a fasthttp handler in process, requests are sent
+// through an in-memory listener instead of the network. The host of
+// Config.Url is ignored and it defaults to http://localhost/.
+func RunHandler(ctx context.Context, c Config, h fasthttp.RequestHandler) (*Result, error) {
+	hs := StartHandler(h)
+	defer func() { _ = hs.Close() }()
+
+	return hs.Run(ctx, c)
+}
+
+// HandlerServer serves a fasthttp handler through an in-memory listener,
+// so that benchmarks of it don't include starting and shutting down
+type HandlerServer struct {
+	ln *fasthttputil.InmemoryListener
+	s  *fasthttp.Server
+}
+
+// StartHandler starts serving h in memory, call Close when it's done
+func StartHandler(h fasthttp.RequestHandler) *HandlerServer {
+	hs := &HandlerServer{
+		ln: fasthttputil.NewInmemoryListener(),
+		s:  &fasthttp.Server{Handler: h},
+	}
+	go func() { _ = hs.s.Serve(hs.ln) }()
+
+	return hs
+}
+
+// Run benchmarks the handler like RunHandler
+func (hs *HandlerServer) Run(ctx context.Context, c Config) (*Result, error) {
+	if c.Url == "" {
+		c.Url = "http://localhost/"
+	}
+	c.inmemory = hs.ln
+
+	return New(c).RunContext(ctx)
+}
+
+// Close shuts down the server
+func (hs *HandlerServer) Close() error {
+	return hs.s.Shutdown()
+}
+
+// RunHTTPHandler is like RunHandler but benchmarks a net/http handler
+func RunHTTPHandler(ctx context.Context, c Config, h http.Handler) (*Result, error) {
+	return RunHandler(ctx, c, fasthttpadaptor.NewFastHTTPHandler(h))
+}
+
+// Thresholds are limits checked against a Result, zero values are not checked
+type Thresholds struct {
+	// MinRps is the minimum average requests per second
+	MinRps float64
+	// MaxLatencyAvg is the maximum average latency
+	MaxLatencyAvg time.Duration
+	// MaxLatencyP99 is the maximum 99th percentile latency
+	MaxLatencyP99 time.Duration
+	// MaxErrorRate is the maximum ratio of failed requests, between 0 and 1
+	MaxErrorRate float64
+	// MaxNon2xx is the maximum number of responses whose status code is not 2xx
+	MaxNon2xx int64
+}
+
+// Check returns an error which describes all exceeded thresholds,
+// it returns nil if the result is within th
+func (r *Result) Check(th Thresholds) error {
+	var failures []string
+
+	if th.MinRps > 0 && r.Rps.Avg < th.MinRps {
+		failures = append(failures, fmt.Sprintf("rps %.2f is less than %.2f", r.Rps.Avg, th.MinRps))
+	}
+
+	if th.MaxLatencyAvg > 0 && r.Latency.Avg > th.MaxLatencyAvg {
+		failures = append(failures, fmt.Sprintf("latency avg %s is greater than %s", r.Latency.Avg, th.MaxLatencyAvg))
+	}
+
+	if th.MaxLatencyP99 > 0 && r.Latency.P99 > th.MaxLatencyP99 {
+		failures = append(failures, fmt.Sprintf("latency p99 %s is greater than %s", r.Latency.P99, th.MaxLatencyP99))
+	}
+
+	if th.MaxErrorRate > 0 {
+		if rate := r.errorRate(); rate > th.MaxErrorRate {
+			failures = append(failures, fmt.Sprintf("error rate %.4f is greater than %.4f", rate, th.MaxErrorRate))
+		}
+	}
+
+	if th.MaxNon2xx > 0 {
+		if n := r.Requests - r.Code2xx; n > th.MaxNon2xx {
+			failures = append(failures, fmt.Sprintf("non-2xx responses %d are more than %d", n, th.MaxNon2xx))
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("thresholds exceeded: %s", strings.Join(failures, "; "))
+}
+
+func (r *Result) errorRate() float64 {
+	var errs int64
+	for _, n := range r.Errors {
+		errs += int64(n)
+	}
+
+	if total := r.Requests + errs; total > 0 {
+		return float64(errs) / float64(total)
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+package pit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_RunHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("fasthttp handler", func(t *testing.T) {
+		r, err := RunHandler(context.Background(), Config{Url: "/foo", Count: 50, Connections: 4}, func(ctx *fasthttp.RequestCtx) {
+			if string(ctx.Path()) != "/foo" {
+				ctx.SetStatusCode(fasthttp.StatusNotFound)
+			}
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(50), r.Requests)
+		assert.Equal(t, int64(50), r.Code2xx)
+		assert.True(t, r.Bytes > 0)
+	})
+
+	t.Run("net/http handler", func(t *testing.T) {
+		r, err := RunHTTPHandler(context.Background(), Config{Count: 50, Connections: 4}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "http://localhost/", r.Url)
+		assert.Equal(t, int64(50), r.Code4xx)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		r, err := RunHandler(ctx, Config{Duration: time.Hour, Connections: 1}, func(ctx *fasthttp.RequestCtx) {})
+
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.True(t, r.Requests > 0)
+	})
+}
+
+func Test_Result_Check(t *testing.T) {
+	t.Parallel()
+
+	r := &Result{
+		Requests: 90,
+		Code2xx:  80,
+		Errors:   map[string]int{"timeout": 10},
+		Rps:      RpsResult{Avg: 100},
+		Latency:  LatencyResult{Avg: time.Millisecond, P99: time.Millisecond * 5},
+	}
+
+	assert.Nil(t, r.Check(Thresholds{}))
+	assert.Nil(t, r.Check(Thresholds{
+		MinRps:        100,
+		MaxLatencyAvg: time.Millisecond,
+		MaxLatencyP99: time.Millisecond * 5,
+		MaxErrorRate:  0.1,
+		MaxNon2xx:     10,
+	}))
+
+	err := r.Check(Thresholds{
+		MinRps:        200,
+		MaxLatencyAvg: time.Microsecond,
+		MaxLatencyP99: time.Millisecond,
+		MaxErrorRate:  0.05,
+		MaxNon2xx:     5,
+	})
+	assert.Equal(t, "thresholds exceeded: rps 100.00 is less than 200.00; "+
+		"latency avg 1ms is greater than 1µs; "+
+		"latency p99 5ms is greater than 1ms; "+
+		"error rate 0.1000 is greater than 0.0500; "+
+		"non-2xx responses 10 are more than 5", err.Error())
+}
@@ -0,0 +1,170 @@
+package pit
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// modes of tls handshake benchmark
+const (
+	handshakeOnly    = "only"
+	handshakeRequest = "request"
+)
+
+// sessionTicketWait limits how long a connection waits for session
+// tickets of TLS 1.3 which are sent after handshake
+const sessionTicketWait = time.Millisecond * 50
+
+// handshaker does tls handshakes on new connections by itself,
+// and records them by whether sessions are resumed
+type handshaker struct {
+	full *tls.Config
+	// resumed has a session cache, it's nil if resumption isn't compared
+	resumed *tls.Config
+	n       uint64
+	timeout time.Duration
+	stats   *group
+}
+
+func newHandshaker(c *Config) (*handshaker, error) {
+	switch {
+	case c.Handshake != handshakeOnly && c.Handshake != handshakeRequest:
+		return nil, fmt.Errorf("invalid handshake mode %q, only and request are supported", c.Handshake)
+	case !c.isTLS:
+		return nil, errors.New("handshake mode needs an https url")
+	case c.Http2:
+		return nil, errors.New("handshake mode doesn't work with http2")
+	case c.Resume && c.DisableSessionTickets:
+		return nil, errors.New("resume doesn't work with disabled session tickets")
+	}
+
+	h := &handshaker{
+		full:    c.tlsClientConf(),
+		timeout: c.Timeout,
+		stats:   c.newGroup("TLS handshakes", "handshakes"),
+	}
+
+	// full handshakes never resume sessions
+	h.full.ClientSessionCache = nil
+	if c.Resume {
+		h.resumed = c.tlsClientConf()
+		h.resumed.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	return h, nil
+}
+
+// config returns the tls config of the next handshake, every other
+// handshake uses the session cache if resumption is compared
+func (h *handshaker) config() *tls.Config {
+	if h.resumed != nil && atomic.AddUint64(&h.n, 1)%2 == 0 {
+		return h.resumed
+	}
+	return h.full
+}
+
+// handshake dials a new connection and does a tls handshake with conf
+func (h *handshaker) handshake(dial fasthttp.DialFunc, addr string, conf *tls.Config) (*tls.Conn, time.Duration, error) {
+	conn, err := dial(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := time.Now()
+	tc := tls.Client(conn, conf)
+	if h.timeout > 0 {
+		_ = tc.SetDeadline(start.Add(h.timeout))
+	}
+	if err = tc.Handshake(); err != nil {
+		_ = conn.Close()
+		key := "full"
+		if conf.ClientSessionCache != nil {
+			key = "resumed"
+		}
+		h.stats.add(key, 0, err)
+		return nil, 0, err
+	}
+	latency := time.Since(start)
+	_ = tc.SetDeadline(time.Time{})
+
+	key := "full"
+	if tc.ConnectionState().DidResume {
+		key = "resumed"
+	}
+	h.stats.add(key, latency, nil)
+
+	return tc, latency, nil
+}
+
+// dialer wraps dial to do handshakes by itself, so that
+// every new connection is recorded
+func (h *handshaker) dialer(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, _, err := h.handshake(dial, addr, h.config())
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// handshakeClient only does tls handshakes on new connections
+// without sending requests
+type handshakeClient struct {
+	*handshaker
+	dial fasthttp.DialFunc
+	addr string
+}
+
+func newHandshakeClient(c *Config) (hc *handshakeClient, err error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	if err = c.setReqBasic(req); err != nil {
+		return
+	}
+
+	if c.tlsConf, err = c.getTlsConfig(); err != nil {
+		return
+	}
+
+	hc = &handshakeClient{dial: c.getDialer(), addr: c.addr}
+	if hc.handshaker, err = newHandshaker(c); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// do does a handshake as a request, there is no status code
+func (c *handshakeClient) do() (code int, latency time.Duration, err error) {
+	conf := c.config()
+
+	var conn *tls.Conn
+	if conn, latency, err = c.handshake(c.dial, c.addr, conf); err != nil {
+		return
+	}
+
+	// session tickets of TLS 1.3 are sent after handshake,
+	// read them so that later handshakes can be resumed
+	cs := conn.ConnectionState()
+	if conf.ClientSessionCache != nil && !cs.DidResume && cs.Version == tls.VersionTLS13 {
+		_ = conn.SetReadDeadline(time.Now().Add(sessionTicketWait))
+		_, _ = conn.Read(make([]byte, 1))
+	}
+
+	_ = conn.Close()
+
+	return
+}
+
+func (c *handshakeClient) doOnce() error {
+	_, _, err := c.do()
+	return err
+}
@@ -0,0 +1,66 @@
+package pit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Handshake(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(ts.Close)
+
+	run := func(c Config) *Result {
+		c.Url = ts.URL
+		c.Insecure = true
+		c.Connections = 2
+		c.Duration = time.Millisecond * 300
+		r, err := New(c).RunContext(context.Background())
+		assert.Nil(t, err)
+		return r
+	}
+
+	t.Run("only", func(t *testing.T) {
+		r := run(Config{Handshake: handshakeOnly})
+		stats := r.Groups["TLS handshakes"]
+		assert.True(t, stats["full"].Requests > 0)
+		assert.Zero(t, stats["resumed"].Requests)
+		// handshakes in flight at the end are not counted as requests
+		assert.InDelta(t, r.Requests, stats["full"].Requests, 2)
+		assert.True(t, r.Latency.P99 > 0)
+	})
+
+	t.Run("only with resume", func(t *testing.T) {
+		r := run(Config{Handshake: handshakeOnly, Resume: true})
+		stats := r.Groups["TLS handshakes"]
+		assert.True(t, stats["full"].Requests > 0)
+		assert.True(t, stats["resumed"].Requests > 0)
+	})
+
+	t.Run("request", func(t *testing.T) {
+		r := run(Config{Handshake: handshakeRequest, Resume: true})
+		stats := r.Groups["TLS handshakes"]
+		assert.True(t, r.Code2xx > 0)
+		assert.InDelta(t, r.Requests, stats["full"].Requests+stats["resumed"].Requests, 2)
+		assert.True(t, stats["resumed"].Requests > 0)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, c := range []Config{
+			{Url: ts.URL, Handshake: "unknown"},
+			{Url: "http://localhost", Handshake: handshakeOnly},
+			{Url: ts.URL, Handshake: handshakeRequest, Http2: true},
+			{Url: ts.URL, Handshake: handshakeOnly, Resume: true, DisableSessionTickets: true},
+		} {
+			assert.NotNil(t, New(c).init(), c)
+		}
+	})
+}
@@ -15,19 +15,24 @@ func (h headers) writeToFasthttp(req *fasthttp.Request) error {
 		return err
 	}
 	for i := 0; i < len(kvs); i += 2 {
-		k, v := strings.ToLower(kvs[i]), kvs[i+1]
-		switch k {
-		case "host":
-			req.URI().SetHost(v)
-		case "content-type", "user-agent", "content-length", "connection", "transfer-encoding":
-			req.Header.Set(k, v)
-		default:
-			req.Header.Add(k, v)
-		}
+		addHeader(req, kvs[i], kvs[i+1])
 	}
 	return nil
 }
 
+// addHeader adds a header into req, host and headers
+// which can only be set once are overridden
+func addHeader(req *fasthttp.Request, k, v string) {
+	switch k = strings.ToLower(k); k {
+	case "host":
+		req.URI().SetHost(v)
+	case "content-type", "user-agent", "content-length", "connection", "transfer-encoding":
+		req.Header.Set(k, v)
+	default:
+		req.Header.Add(k, v)
+	}
+}
+
 func (h headers) kvs() ([]string, error) {
 	list := make([]string, 0, len(h)*2)
 	for _, header := range h {
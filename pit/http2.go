@@ -0,0 +1,333 @@
+package pit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/http2"
+)
+
+// keys of negotiated protocols
+const (
+	protoH2    = "h2"
+	protoH2c   = "h2c"
+	protoHttp1 = "http/1.1"
+)
+
+var errH2Fallback = errors.New("server falls back to http/1.1")
+
+// h2Transport sends requests over http/2 streams, every worker sends
+// one stream at a time. Streams are multiplexed over connections, and
+// a new connection is opened if every open one carries max streams or
+// the limit advertised by the server. Cleartext urls use h2c with
+// prior knowledge.
+type h2Transport struct {
+	t          *http2.Transport
+	dial       fasthttp.DialFunc
+	addr       string
+	tlsConf    *tls.Config
+	maxStreams int
+	timeout    time.Duration
+	// h1 sends requests once the server falls back to http/1.1
+	h1        *fasthttp.HostClient
+	fallback  int32
+	mut       sync.Mutex
+	conns     []*h2Conn
+	dials     []*h2Dial
+	protocols *counter
+}
+
+type h2Conn struct {
+	*http2.ClientConn
+	// streams is guarded by the mutex of transport
+	streams int
+}
+
+// h2Dial is a connection being dialed without the mutex of transport,
+// requests which find no room in connections wait for it
+type h2Dial struct {
+	done chan struct{}
+	cc   *h2Conn
+	err  error
+	// streams are requests waiting for the connection, reserved are
+	// streams reserved for them once it's dialed, both are guarded
+	// by the mutex of transport
+	streams  int
+	reserved int
+}
+
+func (c *Config) newH2Transport() *h2Transport {
+	t := &h2Transport{
+		t:          &http2.Transport{AllowHTTP: !c.isTLS},
+		dial:       c.getDialer(),
+		addr:       c.addr,
+		maxStreams: c.H2MaxStreams,
+		timeout:    c.Timeout,
+		h1:         c.newHostClient(),
+		protocols:  c.newCounter("Negotiated protocols"),
+	}
+
+	if c.isTLS {
+		tlsConf := c.tlsClientConf
+		if c.debugTrace != nil {
+			// handshakes are inspected by debug trace
+			tlsConf = c.debugTrace.h2TlsConf.Clone
+		}
+
+		// http2 client does tls handshake by itself with ALPN, so that
+		// the negotiated protocol is known, dialers never do tls
+		t.tlsConf = tlsConf()
+		if len(t.tlsConf.NextProtos) == 0 {
+			t.tlsConf.NextProtos = []string{protoH2, protoHttp1}
+		}
+		t.h1.TLSConfig = tlsConf()
+		t.h1.TLSConfig.NextProtos = withoutProto(t.tlsConf.NextProtos, protoH2)
+	}
+
+	dial := t.h1.Dial
+	t.h1.Dial = func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err == nil {
+			t.protocols.add(protoHttp1, 1)
+		}
+		return conn, err
+	}
+
+	return t
+}
+
+func withoutProto(protos []string, proto string) []string {
+	ps := make([]string, 0, len(protos))
+	for _, p := range protos {
+		if p != proto {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// do is the transport of fasthttp host client
+func (t *h2Transport) do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	if atomic.LoadInt32(&t.fallback) == 1 {
+		return t.h1.Do(req, resp)
+	}
+
+	ctx := context.Background()
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	// the request is built before a stream is reserved,
+	// so that a failure never holds the reservation
+	hreq, err := newHttpRequest(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	cc, err := t.acquireConn()
+	if err == errH2Fallback {
+		return t.h1.Do(req, resp)
+	}
+	if err != nil {
+		return err
+	}
+	defer t.releaseConn(cc)
+
+	hresp, err := cc.RoundTrip(hreq)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = hresp.Body.Close() }()
+
+	resp.Header.SetProtocol([]byte(hresp.Proto))
+	resp.SetStatusCode(hresp.StatusCode)
+	for k, vs := range hresp.Header {
+		for _, v := range vs {
+			resp.Header.Add(k, v)
+		}
+	}
+	_, err = io.Copy(resp.BodyWriter(), hresp.Body)
+
+	return err
+}
+
+// acquireConn returns a connection with a reserved stream, a new
+// connection is dialed outside the lock so that requests on other
+// connections are not blocked by dialing and handshakes
+func (t *h2Transport) acquireConn() (*h2Conn, error) {
+	t.mut.Lock()
+
+	conns := t.conns[:0]
+	var acquired *h2Conn
+	for _, cc := range t.conns {
+		st := cc.State()
+		if st.Closed || st.Closing && cc.streams == 0 {
+			_ = cc.Close()
+			continue
+		}
+		conns = append(conns, cc)
+		if acquired == nil && (t.maxStreams <= 0 || cc.streams < t.maxStreams) && cc.ReserveNewRequest() {
+			acquired = cc
+		}
+	}
+	t.conns = conns
+
+	if acquired != nil {
+		acquired.streams++
+		t.mut.Unlock()
+		return acquired, nil
+	}
+
+	// wait for a connection being dialed if it has room,
+	// otherwise reserve a new one
+	var d *h2Dial
+	for _, pending := range t.dials {
+		if t.maxStreams <= 0 || pending.streams < t.maxStreams {
+			d = pending
+			break
+		}
+	}
+	dialing := d == nil
+	if dialing {
+		d = &h2Dial{done: make(chan struct{})}
+		t.dials = append(t.dials, d)
+	}
+	d.streams++
+	t.mut.Unlock()
+
+	if dialing {
+		t.dialPending(d)
+	} else {
+		<-d.done
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	t.mut.Lock()
+	if d.reserved > 0 {
+		d.reserved--
+		t.mut.Unlock()
+		return d.cc, nil
+	}
+	t.mut.Unlock()
+
+	// the server allows fewer streams than requests waiting
+	return t.acquireConn()
+}
+
+// dialPending dials the pending connection, adds it to connections
+// and reserves streams for requests waiting for it
+func (t *h2Transport) dialPending(d *h2Dial) {
+	cc, err := t.dialConn()
+
+	t.mut.Lock()
+	for i, pending := range t.dials {
+		if pending == d {
+			t.dials = append(t.dials[:i], t.dials[i+1:]...)
+			break
+		}
+	}
+	d.cc, d.err = cc, err
+	if err == nil {
+		for d.reserved < d.streams && cc.ReserveNewRequest() {
+			d.reserved++
+		}
+		cc.streams += d.reserved
+		t.conns = append(t.conns, cc)
+	}
+	t.mut.Unlock()
+
+	close(d.done)
+}
+
+func (t *h2Transport) releaseConn(cc *h2Conn) {
+	t.mut.Lock()
+	cc.streams--
+	t.mut.Unlock()
+}
+
+func (t *h2Transport) dialConn() (*h2Conn, error) {
+	conn, err := t.dial(t.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	proto := protoH2c
+	if t.tlsConf != nil {
+		tc := tls.Client(conn, t.tlsConf)
+		if t.timeout > 0 {
+			_ = tc.SetDeadline(time.Now().Add(t.timeout))
+		}
+		if err = tc.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		_ = tc.SetDeadline(time.Time{})
+
+		if proto = tc.ConnectionState().NegotiatedProtocol; proto != protoH2 {
+			// the connection is dropped and the http/1.1
+			// client records its own connections
+			_ = tc.Close()
+			atomic.StoreInt32(&t.fallback, 1)
+			return nil, errH2Fallback
+		}
+		conn = tc
+	}
+
+	cc, err := t.t.NewClientConn(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	t.protocols.add(proto, 1)
+
+	return &h2Conn{ClientConn: cc}, nil
+}
+
+// newHttpRequest converts req to an http request of net/http
+func newHttpRequest(ctx context.Context, req *fasthttp.Request) (*http.Request, error) {
+	var body io.Reader = http.NoBody
+	contentLength := int64(-1)
+	if req.IsBodyStream() {
+		body = req.BodyStream()
+		if n := req.Header.ContentLength(); n >= 0 {
+			contentLength = int64(n)
+		}
+	} else if b := req.Body(); len(b) > 0 {
+		body = bytes.NewReader(b)
+		contentLength = int64(len(b))
+	} else {
+		contentLength = 0
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, string(req.Header.Method()), req.URI().String(), body)
+	if err != nil {
+		return nil, err
+	}
+	hreq.ContentLength = contentLength
+	hreq.Host = string(req.Host())
+
+	req.Header.VisitAll(func(key, value []byte) {
+		switch string(key) {
+		case fasthttp.HeaderHost, fasthttp.HeaderConnection,
+			fasthttp.HeaderContentLength, fasthttp.HeaderTransferEncoding:
+			// they are set by http2 client or not allowed
+		default:
+			hreq.Header.Add(string(key), string(value))
+		}
+	})
+
+	return hreq, nil
+}
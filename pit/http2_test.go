@@ -0,0 +1,167 @@
+package pit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func Test_H2Transport(t *testing.T) {
+	t.Parallel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+		}
+	})
+
+	run := func(c Config) *Result {
+		c.Connections = 4
+		c.Duration = time.Millisecond * 200
+		c.Http2 = true
+		r, err := New(c).RunContext(context.Background())
+		assert.Nil(t, err)
+		assert.Empty(t, r.Errors)
+		return r
+	}
+
+	t.Run("h2", func(t *testing.T) {
+		ts := httptest.NewUnstartedServer(handler)
+		ts.EnableHTTP2 = true
+		ts.StartTLS()
+		t.Cleanup(ts.Close)
+
+		r := run(Config{Url: ts.URL, Insecure: true, H2MaxStreams: 2})
+		assert.True(t, r.Code2xx > 0)
+		assert.Zero(t, r.Code5xx)
+		assert.Equal(t, map[string]int64{protoH2: 2}, r.Counters["Negotiated protocols"])
+	})
+
+	t.Run("h2c", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		s := &http.Server{Handler: h2c.NewHandler(handler, &http2.Server{})}
+		go func() { _ = s.Serve(ln) }()
+		t.Cleanup(func() { _ = s.Close() })
+
+		r := run(Config{Url: "http://" + ln.Addr().String()})
+		assert.True(t, r.Code2xx > 0)
+		assert.Zero(t, r.Code5xx)
+		assert.Equal(t, map[string]int64{protoH2c: 1}, r.Counters["Negotiated protocols"])
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		ts := httptest.NewTLSServer(handler)
+		t.Cleanup(ts.Close)
+
+		r := run(Config{Url: ts.URL, Insecure: true})
+		assert.True(t, r.Code5xx > 0)
+		protocols := r.Counters["Negotiated protocols"]
+		assert.Zero(t, protocols[protoH2])
+		assert.True(t, protocols[protoHttp1] > 0)
+	})
+}
+
+func Test_H2Transport_acquireConn(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &http.Server{Handler: h2c.NewHandler(http.NotFoundHandler(), &http2.Server{})}
+	go func() { _ = s.Serve(ln) }()
+	t.Cleanup(func() { _ = s.Close() })
+
+	var (
+		dials   int32
+		dialing = make(chan struct{})
+		unblock = make(chan struct{})
+	)
+	tr := &h2Transport{
+		t:          &http2.Transport{AllowHTTP: true},
+		addr:       ln.Addr().String(),
+		maxStreams: 1,
+		protocols:  newCounter("Negotiated protocols"),
+		dial: func(addr string) (net.Conn, error) {
+			if atomic.AddInt32(&dials, 1) == 2 {
+				close(dialing)
+				<-unblock
+			}
+			return net.Dial("tcp", addr)
+		},
+	}
+
+	cc1, err := tr.acquireConn()
+	assert.Nil(t, err)
+
+	acquired := make(chan *h2Conn)
+	go func() {
+		cc, err := tr.acquireConn()
+		assert.Nil(t, err)
+		acquired <- cc
+	}()
+	<-dialing
+
+	// the first connection is available while the second one is dialed
+	tr.releaseConn(cc1)
+	done := make(chan *h2Conn)
+	go func() {
+		cc, _ := tr.acquireConn()
+		done <- cc
+	}()
+	select {
+	case cc := <-done:
+		assert.True(t, cc1 == cc)
+	case <-time.After(time.Second):
+		t.Fatal("acquireConn is blocked by dialing")
+	}
+
+	close(unblock)
+	cc2 := <-acquired
+	assert.True(t, cc1 != cc2)
+	assert.Equal(t, 1, cc2.streams)
+	assert.Len(t, tr.conns, 2)
+	assert.Empty(t, tr.dials)
+}
+
+func Test_H2Transport_do_invalidRequest(t *testing.T) {
+	t.Parallel()
+
+	var dials int32
+	tr := &h2Transport{
+		t:         &http2.Transport{AllowHTTP: true},
+		addr:      "127.0.0.1:0",
+		protocols: newCounter("Negotiated protocols"),
+		dial: func(addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return nil, errors.New("dial is not expected")
+		},
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI("http://127.0.0.1/")
+	req.Header.SetMethod("BAD METHOD")
+
+	// no stream is reserved for a request which can't be converted
+	assert.EqualError(t, tr.do(req, &fasthttp.Response{}), `net/http: invalid method "BAD METHOD"`)
+	assert.Zero(t, atomic.LoadInt32(&dials))
+	assert.Empty(t, tr.conns)
+}
+
+func Test_withoutProto(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"http/1.1"}, withoutProto([]string{"h2", "http/1.1"}, "h2"))
+	assert.Equal(t, []string{}, withoutProto(nil, "h2"))
+}
@@ -0,0 +1,341 @@
+package pit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/valyala/fasthttp"
+)
+
+// keys of quic handshakes
+const (
+	quicFull    = "full"
+	quicResumed = "resumed"
+	quic0RTT    = "0-RTT"
+)
+
+// http3Client sends requests over QUIC, connections are dialed by
+// quic-go, so that dialers of tcp don't work with it
+type http3Client struct {
+	transports []*http3Transport
+	next       uint32
+	tlsConf    *tls.Config
+	quicConf   *quic.Config
+	// rawReq is built like requests of fasthttp client and converted
+	// to a net/http request every time
+	rawReq      *fasthttp.Request
+	addr        string
+	url         string
+	zeroRtt     bool
+	oauth2      *oauth2Source
+	timeout     time.Duration
+	resolves    map[string][]string
+	nextResolve uint32
+	remoteAddrs *group
+	// closeConn if true, every request is sent on a new connection
+	closeConn  bool
+	handshakes *group
+	wc         io.WriteCloser
+}
+
+// http3Transport remembers the remote ip of its connection
+type http3Transport struct {
+	*http3.RoundTripper
+	remote atomic.Value
+}
+
+func newHttp3Client(c *Config) (hc *http3Client, err error) {
+	hc = &http3Client{
+		rawReq:      fasthttp.AcquireRequest(),
+		zeroRtt:     c.ZeroRtt,
+		timeout:     c.Timeout,
+		resolves:    c.resolves,
+		remoteAddrs: c.remoteAddrs,
+		closeConn:   c.DisableKeepAlives,
+		wc:          defaultWriteCloser{Writer: os.Stdout},
+	}
+
+	switch {
+	case c.Http2 || c.Grpc || c.Pipeline || c.Stream:
+		return nil, errors.New("http3 doesn't work with http2, grpc, pipeline or stream body")
+	case c.UnixSocket != "" || len(c.proxies) > 0 || len(c.LocalAddrs) > 0 || c.proxyProto != nil:
+		return nil, errors.New("http3 doesn't work with unix socket, proxies, local addresses or PROXY protocol")
+	case c.Signer != nil || c.HmacKey != "" || c.AwsSigV4 != "":
+		return nil, errors.New("request signing is not supported with http3")
+	case c.Compressed || c.Decompress:
+		return nil, errors.New("compressed responses are not supported with http3")
+	case c.ZeroRtt && c.Method != http.MethodGet:
+		return nil, errors.New("0-RTT only works with GET requests")
+	case c.ZeroRtt && c.DisableSessionTickets:
+		return nil, errors.New("0-RTT doesn't work with disabled session tickets")
+	}
+
+	if err = c.parseArgs(); err != nil {
+		return
+	}
+	if err = c.setReqBasic(hc.rawReq); err != nil {
+		return
+	}
+	if !c.isTLS {
+		return nil, errors.New("http3 needs an https url")
+	}
+	hc.addr = c.addr
+
+	if err = c.setReqBody(hc.rawReq); err != nil {
+		return
+	}
+	if c.rawBodySize > 0 {
+		// every request sends the same body, so it's recorded once
+		c.newCompression("Request compression").add("gzip", len(c.body), c.rawBodySize)
+	}
+
+	if err = c.setReqHeader(hc.rawReq); err != nil {
+		return
+	}
+	if err = c.setReqAuth(hc.rawReq); err != nil {
+		return
+	}
+	if len(hc.rawReq.Header.UserAgent()) == 0 {
+		hc.rawReq.Header.SetUserAgent("httpit/" + Version)
+	}
+	hc.url = hc.rawReq.URI().String()
+
+	if c.tlsConf, err = c.getTlsConfig(); err != nil {
+		return
+	}
+	hc.tlsConf = c.tlsClientConf()
+	if c.ZeroRtt && hc.tlsConf.ClientSessionCache == nil {
+		// 0-RTT is only sent on resumed sessions
+		hc.tlsConf.ClientSessionCache = tls.NewLRUClientSessionCache(c.Connections)
+	}
+	if hc.tlsConf.ClientSessionCache != nil {
+		hc.tlsConf.ClientSessionCache = &sessionCache{ClientSessionCache: hc.tlsConf.ClientSessionCache}
+	}
+
+	if hc.oauth2, err = c.getOAuth2Source(); err != nil {
+		return
+	}
+
+	hc.quicConf = &quic.Config{HandshakeIdleTimeout: c.Timeout}
+	hc.handshakes = c.newGroup("QUIC handshakes", "handshakes")
+
+	n := c.Connections
+	if n <= 0 || c.Debug {
+		n = 1
+	}
+	hc.transports = make([]*http3Transport, n)
+	for i := range hc.transports {
+		hc.transports[i] = hc.newTransport()
+	}
+
+	return
+}
+
+func (c *http3Client) newTransport() *http3Transport {
+	t := &http3Transport{}
+	t.RoundTripper = &http3.RoundTripper{
+		TLSClientConfig: c.tlsConf,
+		QuicConfig:      c.quicConf,
+		Dial: func(ctx context.Context, addr string, tlsConf *tls.Config, conf *quic.Config) (quic.EarlyConnection, error) {
+			conn, err := c.dial(ctx, addr, tlsConf, conf)
+			if err == nil {
+				t.remote.Store(remoteIP(conn.RemoteAddr()))
+			}
+			return conn, err
+		},
+	}
+	return t
+}
+
+// dial dials a quic connection and records its handshake, requests
+// may be sent with 0-RTT before the handshake is complete
+func (c *http3Client) dial(ctx context.Context, addr string, tlsConf *tls.Config, conf *quic.Config) (quic.EarlyConnection, error) {
+	resolved := ""
+	if addrs, ok := c.resolves[addr]; ok {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		resolved = addrs[int(atomic.AddUint32(&c.nextResolve, 1)-1)%len(addrs)]
+		addr = net.JoinHostPort(resolved, port)
+	}
+
+	start := time.Now()
+	conn, err := quic.DialAddrEarly(ctx, addr, tlsConf, conf)
+	if err != nil {
+		c.handshakes.add(quicFull, 0, err)
+		if resolved != "" && c.remoteAddrs != nil {
+			c.remoteAddrs.add(resolved, 0, err)
+		}
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-conn.HandshakeComplete():
+			latency := time.Since(start)
+			cs := conn.ConnectionState()
+			key := quicFull
+			if cs.Used0RTT {
+				key = quic0RTT
+			} else if cs.TLS.DidResume {
+				key = quicResumed
+			}
+			c.handshakes.add(key, latency, nil)
+		case <-conn.Context().Done():
+		}
+	}()
+
+	return conn, nil
+}
+
+// sessionCache hands out copies of cached sessions, quic-go updates
+// sessions it gets, which races if connections share them
+type sessionCache struct {
+	tls.ClientSessionCache
+	mut sync.Mutex
+}
+
+func (sc *sessionCache) Get(key string) (*tls.ClientSessionState, bool) {
+	sc.mut.Lock()
+	defer sc.mut.Unlock()
+
+	cs, ok := sc.ClientSessionCache.Get(key)
+	if !ok || cs == nil {
+		return cs, ok
+	}
+
+	ticket, state, err := cs.ResumptionState()
+	if err != nil {
+		return nil, false
+	}
+	b, err := state.Bytes()
+	if err != nil {
+		return nil, false
+	}
+	if state, err = tls.ParseSessionState(b); err != nil {
+		return nil, false
+	}
+	if cs, err = tls.NewResumptionState(ticket, state); err != nil {
+		return nil, false
+	}
+
+	return cs, true
+}
+
+func (sc *sessionCache) Put(key string, cs *tls.ClientSessionState) {
+	sc.mut.Lock()
+	sc.ClientSessionCache.Put(key, cs)
+	sc.mut.Unlock()
+}
+
+func (c *http3Client) transport() *http3Transport {
+	if c.closeConn {
+		return c.newTransport()
+	}
+	i := atomic.AddUint32(&c.next, 1)
+	return c.transports[int(i)%len(c.transports)]
+}
+
+func (c *http3Client) roundTrip(body *[]byte) (req *http.Request, resp *http.Response, rt *http3Transport, err error) {
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	raw := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(raw)
+	c.rawReq.CopyTo(raw)
+	if c.oauth2 != nil {
+		raw.Header.Set(headerAuthorization, c.oauth2.authorization())
+	}
+
+	if req, err = newHttpRequest(ctx, raw); err != nil {
+		return
+	}
+	if c.zeroRtt {
+		req.Method = http3.MethodGet0RTT
+	}
+	// host only changes the Host header, connections go to the url host
+	req.URL.Host = c.addr
+
+	rt = c.transport()
+	if c.closeConn {
+		defer func() { _ = rt.Close() }()
+	}
+
+	if resp, err = rt.RoundTrip(req); err != nil {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if body != nil {
+		*body, err = ioutil.ReadAll(resp.Body)
+	} else {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+	}
+
+	return
+}
+
+func (c *http3Client) do() (code int, latency time.Duration, err error) {
+	start := time.Now()
+	_, resp, rt, err := c.roundTrip(nil)
+	if err != nil {
+		return
+	}
+
+	code = resp.StatusCode
+	latency = time.Since(start)
+
+	if c.remoteAddrs != nil {
+		remote, _ := rt.remote.Load().(string)
+		if remote == "" {
+			remote = "unknown"
+		}
+		c.remoteAddrs.add(remote, latency, nil)
+	}
+
+	return
+}
+
+func (c *http3Client) doOnce() (err error) {
+	var body []byte
+	req, resp, _, err := c.roundTrip(&body)
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintf(&buf, "%s %s HTTP/3.0\r\n", req.Method, c.url)
+	writeHttpHeader(&buf, req.Header)
+	_, _ = buf.WriteString("\r\n")
+	writeBody(&buf, c.rawReq.Body(), req.Header.Get("Content-Type"))
+	_, _ = buf.WriteString("\n")
+
+	_, _ = fmt.Fprintf(&buf, "%s %s\r\n", resp.Proto, resp.Status)
+	writeHttpHeader(&buf, resp.Header)
+	_, _ = buf.WriteString("\r\n")
+	writeBody(&buf, body, resp.Header.Get("Content-Type"))
+	_, _ = buf.WriteString("\n")
+
+	_, _ = c.wc.Write(buf.Bytes())
+	_ = c.wc.Close()
+
+	return
+}
@@ -0,0 +1,161 @@
+package pit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Http3(t *testing.T) {
+	t.Parallel()
+
+	url := startHttp3Server(t)
+
+	run := func(c Config) *Result {
+		c.Url = url
+		c.Http3 = true
+		c.Insecure = true
+		c.Connections = 2
+		c.Duration = time.Millisecond * 300
+		r, err := New(c).RunContext(context.Background())
+		assert.Nil(t, err)
+		assert.Empty(t, r.Errors)
+		return r
+	}
+
+	t.Run("keep alive", func(t *testing.T) {
+		r := run(Config{Method: http.MethodPost, Body: "hello"})
+		assert.True(t, r.Code2xx > 0)
+		assert.Zero(t, r.Code4xx)
+		assert.True(t, r.Latency.P99 > 0)
+
+		handshakes := r.Groups["QUIC handshakes"]
+		assert.Equal(t, int64(2), handshakes[quicFull].Requests)
+	})
+
+	t.Run("0-RTT", func(t *testing.T) {
+		r := run(Config{Method: http.MethodGet, DisableKeepAlives: true, ZeroRtt: true})
+		assert.True(t, r.Code2xx > 0)
+
+		handshakes := r.Groups["QUIC handshakes"]
+		assert.True(t, handshakes[quicFull].Requests > 0)
+		assert.True(t, handshakes[quic0RTT].Requests > 0)
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		p := New(Config{Url: url + "/debug", Http3: true, Insecure: true, Debug: true, Method: http.MethodGet})
+		assert.Nil(t, p.init())
+
+		var buf bytes.Buffer
+		p.client.(*http3Client).wc = defaultWriteCloser{Writer: &buf}
+		assert.Nil(t, p.doOnce())
+		assert.Contains(t, buf.String(), "HTTP/3.0 200 OK\r\n")
+	})
+
+	t.Run("request items", func(t *testing.T) {
+		p := New(Config{Url: url + "/echo", Http3: true, Insecure: true, Debug: true, Method: http.MethodPost,
+			Args: []string{"X-Id:1", "a==b", "name=httpit"}, GzipBody: true})
+		assert.Nil(t, p.init())
+
+		var buf bytes.Buffer
+		p.client.(*http3Client).wc = defaultWriteCloser{Writer: &buf}
+		assert.Nil(t, p.doOnce())
+		assert.Contains(t, buf.String(), "POST "+url+"/echo?a=b HTTP/3.0\r\n")
+		assert.Contains(t, buf.String(), "1 a=b name=httpit")
+	})
+
+	t.Run("resolve", func(t *testing.T) {
+		_, port, _ := net.SplitHostPort(strings.TrimPrefix(url, "https://"))
+		r, err := New(Config{
+			Url:         "https://example.com:" + port,
+			Resolve:     []string{"example.com:" + port + ":127.0.0.1"},
+			Http3:       true,
+			Insecure:    true,
+			Count:       2,
+			Connections: 1,
+		}).RunContext(context.Background())
+		assert.Nil(t, err)
+		assert.Empty(t, r.Errors)
+		assert.Equal(t, r.Code2xx, r.Groups["Remote addresses"]["127.0.0.1"].Requests)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, c := range []Config{
+			{Url: url, Http3: true, Compressed: true},
+			{Url: "http://localhost", Http3: true},
+			{Url: url, Http3: true, Http2: true},
+			{Url: url, Http3: true, SocksProxy: "localhost:1080"},
+			{Url: url, Http3: true, ZeroRtt: true, Method: http.MethodPost},
+			{Url: url, Http3: true, ZeroRtt: true, Method: http.MethodGet, DisableSessionTickets: true},
+		} {
+			assert.NotNil(t, New(c).init(), c)
+		}
+	})
+}
+
+func startHttp3Server(t *testing.T) string {
+	ln, err := quic.ListenAddrEarly("127.0.0.1:0",
+		http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{newTestCert(t)}}),
+		&quic.Config{Allow0RTT: true})
+	assert.Nil(t, err)
+
+	s := &http3.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/echo" {
+			// echo request items, the body is sent gzipped
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ := ioutil.ReadAll(zr)
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = fmt.Fprintf(w, "%s %s %s", r.Header.Get("X-Id"), r.URL.RawQuery, body)
+		}
+	})}
+	go func() { _ = s.ServeListener(ln) }()
+	t.Cleanup(func() { _ = s.Close() })
+
+	return "https://" + ln.Addr().String()
+}
+
+// newTestCert creates a self-signed certificate of localhost,
+// sessions of expired certificates are never resumed
+func newTestCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
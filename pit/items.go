@@ -0,0 +1,277 @@
+package pit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// separators of request items like httpie, longer ones
+// go first if they start at the same position
+const (
+	sepJSONFile = ":=@"
+	sepQuery    = "=="
+	sepDataFile = "=@"
+	sepJSON     = ":="
+	sepData     = "="
+	sepFile     = "@"
+	sepHeader   = ":"
+)
+
+var itemSeps = []string{sepJSONFile, sepQuery, sepDataFile, sepJSON, sepData, sepFile, sepHeader}
+
+// requestItem is an extra arg like
+//
+//	Header:Value        request header
+//	param==value        query string parameter
+//	field=value         form field or JSON string
+//	field:=json         raw JSON value
+//	field=@file         form field or JSON string of file content
+//	field:=@file.json   raw JSON value of file content
+//	field@file          file of multipart/form-data request
+//
+// fields of JSON can be nested paths like user[name]=x and tags[]:=1,
+// separators in names can be escaped by backslash
+type requestItem struct {
+	arg   string
+	name  string
+	sep   string
+	value string
+}
+
+// parseRequestItem splits arg by the first separator, an arg without
+// separator is a field without value
+func parseRequestItem(arg string) (*requestItem, error) {
+	item := &requestItem{arg: arg}
+
+	var name strings.Builder
+	for i := 0; i < len(arg); i++ {
+		if arg[i] == '\\' && i+1 < len(arg) {
+			i++
+			name.WriteByte(arg[i])
+			continue
+		}
+
+		for _, sep := range itemSeps {
+			if strings.HasPrefix(arg[i:], sep) {
+				item.sep = sep
+				item.value = arg[i+len(sep):]
+				break
+			}
+		}
+		if item.sep != "" {
+			break
+		}
+		name.WriteByte(arg[i])
+	}
+
+	item.name = strings.TrimSpace(name.String())
+	if item.name == "" {
+		return nil, fmt.Errorf("invalid request item %q, missing name", arg)
+	}
+
+	if item.sep != sepHeader {
+		item.value = strings.TrimSpace(item.value)
+	}
+
+	return item, nil
+}
+
+// isRawJSON reports whether item is a raw JSON value
+func (item *requestItem) isRawJSON() bool {
+	return item.sep == sepJSON || item.sep == sepJSONFile
+}
+
+// text returns value of a data item, file content is embedded
+func (item *requestItem) text(fs *fileSystem) (string, error) {
+	if item.sep != sepDataFile {
+		return item.value, nil
+	}
+
+	b, err := fs.readFile(item.value)
+	if err != nil {
+		return "", fmt.Errorf("request item %q: %w", item.arg, err)
+	}
+	return string(b), nil
+}
+
+// json returns value of item in JSON
+func (item *requestItem) json(fs *fileSystem) ([]byte, error) {
+	switch item.sep {
+	case sepJSON:
+		if needQuote(item.value) {
+			return json.Marshal(item.value)
+		}
+		return []byte(item.value), nil
+	case sepJSONFile:
+		b, err := fs.readFile(item.value)
+		if err != nil {
+			return nil, fmt.Errorf("request item %q: %w", item.arg, err)
+		}
+		if b = bytes.TrimSpace(b); !json.Valid(b) {
+			return nil, fmt.Errorf("request item %q: invalid JSON in %s", item.arg, item.value)
+		}
+		return b, nil
+	case sepData, sepDataFile:
+		s, err := item.text(fs)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(s)
+	}
+
+	return nil, fmt.Errorf("invalid JSON field %q, missing value", item.arg)
+}
+
+// jsonNode is a node of JSON built from request items, keys of objects are
+// kept in the order of their first appearance
+type jsonNode struct {
+	raw    []byte
+	keys   []string
+	fields map[string]*jsonNode
+	items  []*jsonNode
+	// isArray is true if the node is an array, objects have non-nil fields
+	isArray bool
+}
+
+// set sets value of path like user[name], tags[] or items[0][id]
+func (n *jsonNode) set(arg, path string, value []byte) error {
+	keys, err := parseJSONPath(path)
+	if err != nil {
+		return fmt.Errorf("request item %q: %w", arg, err)
+	}
+
+	for i, key := range keys {
+		// the first key is always a key of the top-level object
+		isIndex := i > 0 && isDigits(key)
+		if n, err = n.child(key, isIndex, i == len(keys)-1); err != nil {
+			return fmt.Errorf("request item %q: %w at %s", arg, err, strings.Join(keys[:i+1], "."))
+		}
+	}
+	n.raw = value
+
+	return nil
+}
+
+// child returns the child node of key, it's created if it doesn't exist,
+// key of an array is an index or "" which appends a new item, an index
+// can be at most the length of the array
+func (n *jsonNode) child(key string, isIndex, last bool) (*jsonNode, error) {
+	switch {
+	case n.fields == nil && !n.isArray && n.raw == nil:
+		if isIndex {
+			n.isArray = true
+		} else {
+			n.fields = make(map[string]*jsonNode)
+		}
+	case n.raw != nil || n.isArray != isIndex:
+		return nil, errJSONTypeConflict
+	}
+
+	if n.isArray {
+		index := len(n.items)
+		if key != "" {
+			var err error
+			if index, err = strconv.Atoi(key); err != nil {
+				return nil, fmt.Errorf("invalid index %s: %w", key, err)
+			}
+			if index > len(n.items) {
+				return nil, fmt.Errorf("index %d out of range [0:%d]", index, len(n.items))
+			}
+		}
+		if index == len(n.items) {
+			n.items = append(n.items, &jsonNode{})
+		}
+		child := n.items[index]
+		if last && !child.empty() {
+			return nil, errJSONDuplicate
+		}
+		return child, nil
+	}
+
+	child, ok := n.fields[key]
+	if !ok {
+		child = &jsonNode{}
+		n.fields[key] = child
+		n.keys = append(n.keys, key)
+	} else if last {
+		return nil, errJSONDuplicate
+	}
+	return child, nil
+}
+
+var (
+	errJSONTypeConflict = errors.New("type conflict")
+	errJSONDuplicate    = errors.New("duplicate value")
+)
+
+// isDigits reports whether key is an array index like 0 or "" which appends
+func isDigits(key string) bool {
+	for _, r := range key {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *jsonNode) empty() bool {
+	return n.raw == nil && n.fields == nil && !n.isArray
+}
+
+// appendTo appends JSON of the node to b, items which are not
+// set are null
+func (n *jsonNode) appendTo(b []byte) []byte {
+	switch {
+	case n.raw != nil:
+		return append(b, n.raw...)
+	case n.isArray:
+		b = append(b, '[')
+		for i, item := range n.items {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = item.appendTo(b)
+		}
+		return append(b, ']')
+	case n.fields != nil:
+		b = append(b, '{')
+		for i, key := range n.keys {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			k, _ := json.Marshal(key)
+			b = append(b, k...)
+			b = append(b, ':')
+			b = n.fields[key].appendTo(b)
+		}
+		return append(b, '}')
+	}
+	return append(b, "null"...)
+}
+
+// parseJSONPath splits path like user[name][tags][] into keys
+func parseJSONPath(path string) ([]string, error) {
+	i := strings.IndexByte(path, '[')
+	if i == -1 {
+		return []string{path}, nil
+	}
+	if i == 0 {
+		return nil, fmt.Errorf("invalid path %s", path)
+	}
+
+	keys := []string{path[:i]}
+	for rest := path[i:]; rest != ""; {
+		j := strings.IndexByte(rest, ']')
+		if rest[0] != '[' || j == -1 {
+			return nil, fmt.Errorf("invalid path %s", path)
+		}
+		keys = append(keys, rest[1:j])
+		rest = rest[j+1:]
+	}
+
+	return keys, nil
+}
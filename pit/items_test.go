@@ -0,0 +1,158 @@
+package pit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseRequestItem(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		arg, name, sep, value string
+	}{
+		{"X-Foo:bar", "X-Foo", sepHeader, "bar"},
+		{"Referer:http://example.com", "Referer", sepHeader, "http://example.com"},
+		{"q==a b", "q", sepQuery, "a b"},
+		{" foo = bar ", "foo", sepData, "bar"},
+		{"url=http://a.com?b=c", "url", sepData, "http://a.com?b=c"},
+		{"email=a@example.com", "email", sepData, "a@example.com"},
+		{"foo:=1", "foo", sepJSON, "1"},
+		{"foo=@a.txt", "foo", sepDataFile, "a.txt"},
+		{"foo:=@a.json", "foo", sepJSONFile, "a.json"},
+		{"photo@a.jpg", "photo", sepFile, "a.jpg"},
+		{"user[name]=x", "user[name]", sepData, "x"},
+		{`a\:b=c`, "a:b", sepData, "c"},
+		{`a\=b\@c:=1`, "a=b@c", sepJSON, "1"},
+		{"foo", "foo", "", ""},
+	}
+
+	for _, tc := range testCases {
+		item, err := parseRequestItem(tc.arg)
+		assert.Nil(t, err, tc.arg)
+		assert.Equal(t, tc.name, item.name, tc.arg)
+		assert.Equal(t, tc.sep, item.sep, tc.arg)
+		assert.Equal(t, tc.value, item.value, tc.arg)
+	}
+
+	for _, arg := range []string{"=foo", ":bar", "@file", " ==x"} {
+		_, err := parseRequestItem(arg)
+		assert.NotNil(t, err, arg)
+	}
+}
+
+func Test_Config_parseArgs_Items(t *testing.T) {
+	t.Parallel()
+
+	text := writeFile(t, "a.txt", "hello")
+	data := writeFile(t, "a.json", ` {"b": [1, 2]} `)
+	invalid := writeFile(t, "invalid.json", `{`)
+
+	t.Run("json", func(t *testing.T) {
+		testCases := []struct {
+			args     []string
+			expected string
+		}{
+			{[]string{"name=foo", "age:=18"}, `{"name":"foo","age":18}`},
+			{[]string{`quote=a"b`, "n:=1"}, `{"quote":"a\"b","n":1}`},
+			{[]string{"user[name]=foo", "user[tags][]:=1", "user[tags][]=x", "age:=1"},
+				`{"user":{"name":"foo","tags":[1,"x"]},"age":1}`},
+			{[]string{"items[0][id]:=1", "items[1][id]:=2", "items[0][n]:=3"}, `{"items":[{"id":1,"n":3},{"id":2}]}`},
+			{[]string{"list[0]:=true", "list[]:=false"}, `{"list":[true,false]}`},
+			{[]string{"text=@" + text, "data:=@" + data}, `{"text":"hello","data":{"b": [1, 2]}}`},
+		}
+
+		for _, tc := range testCases {
+			c, _ := configAndReq()
+			c.Args = tc.args
+			assert.Nil(t, c.parseArgs(), tc.args)
+			assert.True(t, c.JSON)
+			assert.Equal(t, tc.expected, string(c.body))
+		}
+	})
+
+	t.Run("json flag", func(t *testing.T) {
+		c, _ := configAndReq()
+		c.JSON = true
+		c.Args = []string{"foo=bar"}
+		assert.Nil(t, c.parseArgs())
+		assert.False(t, c.Form)
+		assert.Equal(t, `{"foo":"bar"}`, string(c.body))
+	})
+
+	t.Run("form", func(t *testing.T) {
+		c, _ := configAndReq()
+		c.Args = []string{"text=@" + text, "a[b]=c"}
+		assert.Nil(t, c.parseArgs())
+		assert.True(t, c.Form)
+		assert.Equal(t, "text=hello&a%5Bb%5D=c", string(c.body))
+	})
+
+	t.Run("headers and queries", func(t *testing.T) {
+		c, req := configAndReq()
+		c.Url = "http://127.0.0.1/foo?a=1"
+		c.Args = []string{"X-Token: abc", "Host:example.com", "b==2 3", "c==", "d:=4"}
+		assert.Nil(t, c.parseArgs())
+		assert.Equal(t, `{"d":4}`, string(c.body))
+
+		assert.Nil(t, c.setReqBasic(req))
+		assert.Nil(t, c.setReqHeader(req))
+		assert.Equal(t, "example.com", string(req.URI().Host()))
+		assert.Equal(t, "/foo?a=1&b=2+3&c=", string(req.URI().RequestURI()))
+		assert.Equal(t, "abc", string(req.Header.Peek("X-Token")))
+	})
+
+	t.Run("only headers", func(t *testing.T) {
+		c, _ := configAndReq()
+		c.Args = []string{"X-Token:abc"}
+		assert.Nil(t, c.parseArgs())
+		assert.False(t, c.Form)
+		assert.False(t, c.JSON)
+		assert.Empty(t, c.body)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		testCases := []struct {
+			args  []string
+			form  bool
+			json  bool
+			error string
+		}{
+			{args: []string{"a:=1", "f@" + text}, error: `raw JSON can't be sent with file`},
+			{args: []string{"f@" + text}, json: true, error: `file can't be sent in a JSON body`},
+			{args: []string{"a:=1"}, form: true, error: `raw JSON can't be sent in a form body`},
+			{args: []string{"a:=1", "a=2"}, error: `duplicate value at a`},
+			{args: []string{"a:=1", "a[b]=2"}, error: `type conflict at a.b`},
+			{args: []string{"a[]:=1", "a[b]=2"}, error: `type conflict at a.b`},
+			{args: []string{"a[1]:=1"}, error: `index 1 out of range [0:0] at a.1`},
+			{args: []string{"tags[1000000000]:=1"}, error: `index 1000000000 out of range [0:0]`},
+			{args: []string{"a[99999999999999999999]:=1"}, error: `invalid index 99999999999999999999`},
+			{args: []string{"a:=1", "b"}, error: `missing value`},
+			{args: []string{"a[b=1", "c:=1"}, error: `invalid path a[b`},
+			{args: []string{"a:=@" + invalid}, error: `invalid JSON`},
+			{args: []string{"a:=@not-exist"}, error: `not-exist`},
+			{args: []string{"a=@not-exist"}, error: `not-exist`},
+			{args: []string{"=a"}, error: `missing name`},
+		}
+
+		for _, tc := range testCases {
+			c, _ := configAndReq()
+			c.Args, c.Form, c.JSON = tc.args, tc.form, tc.json
+			err := c.parseArgs()
+			if assert.NotNil(t, err, tc.args) {
+				assert.Contains(t, err.Error(), tc.error)
+			}
+		}
+	})
+}
+
+func requestItems(t *testing.T, args ...string) []*requestItem {
+	items := make([]*requestItem, len(args))
+	for i, arg := range args {
+		item, err := parseRequestItem(arg)
+		assert.Nil(t, err)
+		items[i] = item
+	}
+	return items
+}
@@ -0,0 +1,116 @@
+package pit
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
+)
+
+// metrics collects numeric values by name concurrently,
+// it keeps names in the order of their first appearance
+type metrics struct {
+	name  string
+	mut   sync.Mutex
+	keys  []string
+	stats map[string]*metricStat
+}
+
+type metricStat struct {
+	count int64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func newMetrics(name string) *metrics {
+	return &metrics{
+		name:  name,
+		stats: make(map[string]*metricStat),
+	}
+}
+
+// add records a value of key
+func (m *metrics) add(key string, value float64) {
+	m.merge(key, metricStat{count: 1, sum: value, min: value, max: value})
+}
+
+// merge merges a stat of key
+func (m *metrics) merge(key string, ms metricStat) {
+	if ms.count == 0 {
+		return
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	s, ok := m.stats[key]
+	if !ok {
+		s = &metricStat{min: ms.min, max: ms.max}
+		m.stats[key] = s
+		m.keys = append(m.keys, key)
+	}
+
+	s.count += ms.count
+	s.sum += ms.sum
+	if ms.min < s.min {
+		s.min = ms.min
+	}
+	if ms.max > s.max {
+		s.max = ms.max
+	}
+}
+
+// each calls fn with every key and its stat in order
+func (m *metrics) each(fn func(key string, ms metricStat)) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	for _, key := range m.keys {
+		fn(key, *m.stats[key])
+	}
+}
+
+func (m *metrics) get(key string) metricStat {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if s, ok := m.stats[key]; ok {
+		return *s
+	}
+	return metricStat{}
+}
+
+func (ms metricStat) avg() float64 {
+	if ms.count == 0 {
+		return 0
+	}
+	return ms.sum / float64(ms.count)
+}
+
+func (m *metrics) write(buf *bytebufferpool.ByteBuffer) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if len(m.keys) == 0 {
+		return
+	}
+
+	_, _ = buf.WriteString(m.name)
+	_, _ = buf.WriteString(":\n")
+	for _, key := range m.keys {
+		s := m.stats[key]
+		_, _ = buf.WriteString("  ")
+		_, _ = buf.WriteString(key)
+		_, _ = buf.WriteString(" - count ")
+		buf.B = fasthttp.AppendUint(buf.B, int(s.count))
+		_, _ = buf.WriteString(", avg ")
+		buf.B = strconv.AppendFloat(buf.B, s.avg(), 'f', 2, 64)
+		_, _ = buf.WriteString(", min ")
+		buf.B = strconv.AppendFloat(buf.B, s.min, 'f', 2, 64)
+		_, _ = buf.WriteString(", max ")
+		buf.B = strconv.AppendFloat(buf.B, s.max, 'f', 2, 64)
+		_ = buf.WriteByte('\n')
+	}
+}
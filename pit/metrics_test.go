@@ -0,0 +1,35 @@
+package pit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/bytebufferpool"
+)
+
+func Test_metrics(t *testing.T) {
+	t.Parallel()
+
+	m := newMetrics("Metrics")
+
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	m.write(buf)
+	assert.Equal(t, "", buf.String())
+
+	m.add("b", 1)
+	m.add("b", 3)
+	m.add("a", -1.5)
+	m.merge("a", metricStat{})
+
+	assert.Equal(t, metricStat{count: 2, sum: 4, min: 1, max: 3}, m.get("b"))
+	assert.Equal(t, float64(2), m.get("b").avg())
+	assert.Equal(t, metricStat{count: 1, sum: -1.5, min: -1.5, max: -1.5}, m.get("a"))
+	assert.Equal(t, float64(0), m.get("c").avg())
+
+	m.write(buf)
+	assert.Equal(t, "Metrics:\n"+
+		"  b - count 2, avg 2.00, min 1.00, max 3.00\n"+
+		"  a - count 1, avg -1.50, min -1.50, max -1.50\n", buf.String())
+}
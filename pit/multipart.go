@@ -0,0 +1,152 @@
+package pit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+)
+
+const defaultFileContentType = "application/octet-stream"
+
+// multipartBody is a multipart/form-data body of fields and files, files are
+// read when the body is built or streamed, the body is made up of chunks with
+// a file between every two of them
+type multipartBody struct {
+	fs          *fileSystem
+	contentType string
+	chunks      [][]byte
+	files       []string
+}
+
+// newMultipartBody builds a multipart body of fields, files
+// are like photo@./photo.jpg;type=image/jpeg
+func newMultipartBody(fs *fileSystem, fields []*requestItem) (*multipartBody, error) {
+	var (
+		buf bytes.Buffer
+		w   = multipart.NewWriter(&buf)
+		mb  = &multipartBody{fs: fs, contentType: w.FormDataContentType()}
+		// start of the current chunk in buf
+		start int
+	)
+
+	for _, item := range fields {
+		if item.sep != sepFile {
+			value, err := item.text(fs)
+			if err != nil {
+				return nil, err
+			}
+			if err = w.WriteField(item.name, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		name, file, contentType := item.name, item.value, ""
+		if j := strings.Index(file, ";type="); j != -1 {
+			file, contentType = file[:j], file[j+len(";type="):]
+		}
+		if contentType == "" {
+			contentType = fileContentType(file)
+		}
+
+		if err := fs.stat(file); err != nil {
+			return nil, err
+		}
+
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes(name), escapeQuotes(filepath.Base(file))))
+		h.Set("Content-Type", contentType)
+		if _, err := w.CreatePart(h); err != nil {
+			return nil, err
+		}
+
+		// the file content goes right after part headers
+		mb.chunks = append(mb.chunks, buf.Bytes()[start:])
+		mb.files = append(mb.files, filepath.Clean(file))
+		start = buf.Len()
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	mb.chunks = append(mb.chunks, buf.Bytes()[start:])
+
+	return mb, nil
+}
+
+// bytes builds the whole body
+func (mb *multipartBody) bytes() ([]byte, error) {
+	var b []byte
+	for i, chunk := range mb.chunks {
+		b = append(b, chunk...)
+		if i < len(mb.files) {
+			data, err := mb.fs.readFile(mb.files[i])
+			if err != nil {
+				return nil, err
+			}
+			b = append(b, data...)
+		}
+	}
+	return b, nil
+}
+
+// open opens files and returns a stream of the body with its size,
+// files are closed when the stream is closed
+func (mb *multipartBody) open() (io.ReadCloser, int, error) {
+	s := &multipartStream{}
+	readers := make([]io.Reader, 0, len(mb.chunks)+len(mb.files))
+	size := 0
+
+	for i, chunk := range mb.chunks {
+		readers = append(readers, bytes.NewReader(chunk))
+		size += len(chunk)
+		if i == len(mb.files) {
+			break
+		}
+
+		f, n, err := mb.fs.open(mb.files[i])
+		if err != nil {
+			_ = s.Close()
+			return nil, 0, err
+		}
+		s.files = append(s.files, f)
+		readers = append(readers, f)
+		size += n
+	}
+
+	s.Reader = io.MultiReader(readers...)
+
+	return s, size, nil
+}
+
+type multipartStream struct {
+	io.Reader
+	files []io.ReadCloser
+}
+
+func (s *multipartStream) Close() error {
+	for _, f := range s.files {
+		_ = f.Close()
+	}
+	return nil
+}
+
+// fileContentType guesses content type by file extension
+func fileContentType(file string) string {
+	if t := mime.TypeByExtension(filepath.Ext(file)); t != "" {
+		return t
+	}
+	return defaultFileContentType
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
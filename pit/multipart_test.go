@@ -0,0 +1,95 @@
+package pit
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_MultipartBody(t *testing.T) {
+	t.Parallel()
+
+	photo := writeFile(t, "photo.jpg", "jpeg data")
+	doc := writeFile(t, "doc", "raw data")
+
+	mb, err := newMultipartBody(nil, requestItems(t, "name=foo", "photo@"+photo, "empty", "doc@"+doc+";type=text/plain"))
+	assert.Nil(t, err)
+
+	body, err := mb.bytes()
+	assert.Nil(t, err)
+	assertMultipart(t, mb.contentType, body)
+
+	t.Run("stream", func(t *testing.T) {
+		s, size, err := mb.open()
+		assert.Nil(t, err)
+		b, err := ioutil.ReadAll(s)
+		assert.Nil(t, err)
+		assert.Nil(t, s.Close())
+		assert.Equal(t, len(body), size)
+		assert.Equal(t, body, b)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := newMultipartBody(nil, requestItems(t, "file@not-exist.jpg"))
+		assert.NotNil(t, err)
+	})
+}
+
+func Test_Multipart_Every_Request(t *testing.T) {
+	t.Parallel()
+
+	photo := writeFile(t, "photo.jpg", "jpeg data")
+
+	for _, stream := range []bool{false, true} {
+		r, err := RunHandler(context.Background(), Config{
+			Args:   []string{"name=foo", "photo@" + photo},
+			Stream: stream,
+			Count:  10,
+		}, func(ctx *fasthttp.RequestCtx) {
+			form, err := ctx.MultipartForm()
+			if err != nil || !ctx.IsPost() || form.Value["name"][0] != "foo" || len(form.File["photo"]) != 1 ||
+				form.File["photo"][0].Size != int64(len("jpeg data")) {
+				ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			}
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(10), r.Code2xx, stream)
+	}
+}
+
+func assertMultipart(t *testing.T, contentType string, body []byte) {
+	_, params, err := mime.ParseMediaType(contentType)
+	assert.Nil(t, err)
+
+	form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"foo"}, form.Value["name"])
+	assert.Equal(t, []string{""}, form.Value["empty"])
+
+	photo := form.File["photo"][0]
+	assert.Equal(t, "photo.jpg", photo.Filename)
+	assert.Equal(t, "image/jpeg", photo.Header.Get("Content-Type"))
+	assert.Equal(t, int64(len("jpeg data")), photo.Size)
+
+	doc := form.File["doc"][0]
+	assert.Equal(t, "text/plain", doc.Header.Get("Content-Type"))
+	f, err := doc.Open()
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(f)
+	assert.Nil(t, err)
+	assert.Equal(t, "raw data", string(b))
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	file := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, ioutil.WriteFile(file, []byte(content), 0600))
+	return file
+}
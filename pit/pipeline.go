@@ -0,0 +1,137 @@
+package pit
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// keys of pipeline stats
+const (
+	pipelineDepth         = "in-flight per connection"
+	pipelineQueueWait     = "queue wait (ms)"
+	pipelineServerLatency = "server latency (ms)"
+)
+
+// pipelineStats records how deep requests are pipelined, and splits
+// latencies into queue wait and server latency. Responses of a connection
+// are read in order, so a response can't be read until the previous one
+// on the same connection is read, the time before that is queue wait.
+type pipelineStats struct {
+	client *fasthttp.PipelineClient
+	conns  int64
+	stats  *metrics
+}
+
+func (c *Config) newPipelineStats() *pipelineStats {
+	return &pipelineStats{stats: c.newMetrics("Pipeline")}
+}
+
+// dialer wraps dial to count open connections
+func (ps *pipelineStats) dialer(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		atomic.AddInt64(&ps.conns, 1)
+		pc := &pipelineConn{Conn: conn, ps: ps}
+		if _, ok := conn.(interface{ Handshake() error }); ok {
+			// keep telling fasthttp clients that tls is done by dialer
+			return &tlsPipelineConn{pc}, nil
+		}
+		return pc, nil
+	}
+}
+
+// begin records in-flight requests per connection right before
+// a request is sent, the request itself is included
+func (ps *pipelineStats) begin() {
+	conns := atomic.LoadInt64(&ps.conns)
+	if conns <= 0 {
+		conns = 1
+	}
+	ps.stats.add(pipelineDepth, float64(ps.client.PendingRequests()+1)/float64(conns))
+}
+
+// end records queue wait and server latency of a request which is
+// sent at start, and whose response is read at end. The local address
+// of the response tells which connection the request is sent on.
+func (ps *pipelineStats) end(localAddr net.Addr, start, end time.Time) {
+	pa, ok := localAddr.(*pipelineAddr)
+	if !ok {
+		return
+	}
+
+	pc := pa.conn
+	pc.mut.Lock()
+	prev := pc.lastEnd
+	if end.After(prev) {
+		pc.lastEnd = end
+	}
+	pc.mut.Unlock()
+
+	served := start
+	if prev.After(start) {
+		served = prev
+	}
+	if served.After(end) {
+		served = end
+	}
+
+	ps.stats.add(pipelineQueueWait, float64(served.Sub(start))/float64(time.Millisecond))
+	ps.stats.add(pipelineServerLatency, float64(end.Sub(served))/float64(time.Millisecond))
+}
+
+// pipelineConn remembers when the last response is read
+type pipelineConn struct {
+	net.Conn
+	ps      *pipelineStats
+	mut     sync.Mutex
+	lastEnd time.Time
+	closed  int32
+}
+
+// LocalAddr is recorded by responses, so that they can be
+// matched to the connection
+func (pc *pipelineConn) LocalAddr() net.Addr {
+	return &pipelineAddr{Addr: pc.Conn.LocalAddr(), conn: pc}
+}
+
+func (pc *pipelineConn) Close() error {
+	if atomic.CompareAndSwapInt32(&pc.closed, 0, 1) {
+		atomic.AddInt64(&pc.ps.conns, -1)
+	}
+	return pc.Conn.Close()
+}
+
+type pipelineAddr struct {
+	net.Addr
+	conn *pipelineConn
+}
+
+func (pa *pipelineAddr) Network() string {
+	if pa.Addr == nil {
+		return ""
+	}
+	return pa.Addr.Network()
+}
+
+func (pa *pipelineAddr) String() string {
+	if pa.Addr == nil {
+		return ""
+	}
+	return pa.Addr.String()
+}
+
+type tlsPipelineConn struct {
+	*pipelineConn
+}
+
+func (tc *tlsPipelineConn) Handshake() error {
+	return tc.Conn.(interface{ Handshake() error }).Handshake()
+}
@@ -0,0 +1,69 @@
+package pit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_Pipeline(t *testing.T) {
+	t.Parallel()
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Run("stats", func(t *testing.T) {
+		r, err := RunHandler(context.Background(), Config{
+			Connections:   8,
+			Duration:      time.Millisecond * 200,
+			Pipeline:      true,
+			PipelineConns: 1,
+			PipelineDepth: 16,
+		}, handler)
+		assert.Nil(t, err)
+		assert.Empty(t, r.Errors)
+		assert.True(t, r.Code2xx > 0)
+
+		stats := r.Metrics["Pipeline"]
+		assert.True(t, stats[pipelineDepth].Max > 1)
+		assert.True(t, stats[pipelineQueueWait].Avg > 0)
+		assert.True(t, stats[pipelineServerLatency].Avg >= 1)
+		assert.InDelta(t, r.Requests, stats[pipelineServerLatency].Count, 8)
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		r, err := RunHandler(context.Background(), Config{
+			Connections:   8,
+			Count:         50,
+			Pipeline:      true,
+			PipelineConns: 1,
+			PipelineDepth: 1,
+		}, handler)
+		assert.Nil(t, err)
+		assert.Contains(t, r.Errors, fasthttp.ErrPipelineOverflow.Error())
+	})
+}
+
+func Test_pipelineStats_end(t *testing.T) {
+	t.Parallel()
+
+	ps := &pipelineStats{stats: newMetrics("Pipeline")}
+	pc := &pipelineConn{ps: ps}
+	addr := &pipelineAddr{conn: pc}
+	now := time.Now()
+
+	// the first response is served right after it's sent
+	ps.end(addr, now, now.Add(time.Millisecond*2))
+	// the second one waits until the first one is read
+	ps.end(addr, now, now.Add(time.Millisecond*3))
+	// addresses of other connections are ignored
+	ps.end(nil, now, now.Add(time.Second))
+
+	assert.Equal(t, metricStat{count: 2, sum: 2, min: 0, max: 2}, ps.stats.get(pipelineQueueWait))
+	assert.Equal(t, metricStat{count: 2, sum: 3, min: 1, max: 2}, ps.stats.get(pipelineServerLatency))
+	assert.Equal(t, "", addr.String())
+}
@@ -64,6 +64,7 @@ func New(c Config) *Pit {
 	p.tui.duration = p.c.Duration
 	p.tui.connections = p.c.Connections
 	p.tui.throughput = &p.c.throughput
+	p.tui.sections = &p.c.sections
 	p.initCmd = p.run
 
 	return p
@@ -71,6 +72,10 @@ func New(c Config) *Pit {
 
 // Run starts benchmarking
 func (p *Pit) Run() (err error) {
+	if len(p.c.Agents) > 0 && !p.c.Debug {
+		return p.runAgents()
+	}
+
 	if err = p.init(); err != nil {
 		return
 	}
@@ -82,22 +87,109 @@ func (p *Pit) Run() (err error) {
 	return p.tui.start()
 }
 
-func (p *Pit) init() (err error) {
+// runAgents runs benchmark on agents and shows merged statistics
+func (p *Pit) runAgents() (err error) {
+	co, err := p.prepareAgents()
+	if err != nil {
+		return
+	}
+
+	p.tui.agents = len(co.agents)
+	p.tui.connections *= len(co.agents)
+	p.initCmd = co.run
+
+	err = p.tui.start()
+
+	p.mut.Lock()
+	finished := p.done
+	p.mut.Unlock()
+	if !finished {
+		_ = co.stop()
+	}
+
+	return
+}
+
+// prepareAgents ships Config to agents, the coordinator only normalizes
+// the url, agents init the rest by themselves
+func (p *Pit) prepareAgents() (co *coordinator, err error) {
+	if err = p.initUrl(); err != nil {
+		return
+	}
+
+	if co, err = newCoordinator(p); err != nil {
+		return
+	}
+
+	err = co.prepare()
+
+	return
+}
+
+func (p *Pit) initUrl() error {
 	if p.c.Url == "" {
 		return errors.New("missing url")
 	}
 
+	// unix:///run/app.sock:/foo => http://localhost/foo
+	if socket, url, ok := splitUnixSocketUrl(p.c.Url); ok {
+		p.c.UnixSocket, p.c.Url = socket, url
+	}
+
 	// :3000 => http://127.0.0.1
 	// example.com => http://example.com
 	p.c.Url = addMissingSchemaAndHost(p.c.Url)
 	p.tui.url = p.c.Url
 
+	return nil
+}
+
+func (p *Pit) init() (err error) {
+	if err = p.initUrl(); err != nil {
+		return
+	}
+
+	if err = p.c.checkModes(); err != nil {
+		return
+	}
+
+	if err = p.c.parseResolve(); err != nil {
+		return
+	}
+
+	if err = p.c.parseLocalAddrs(); err != nil {
+		return
+	}
+
+	if err = p.c.parseProxies(); err != nil {
+		return
+	}
+
+	if err = p.c.parseProxyProtocol(); err != nil {
+		return
+	}
+
 	if p.c.Qps > 0 {
 		p.limiter = newTokenLimiter(p.c.Qps)
 	}
 
 	if p.client == nil {
-		p.client, err = newFasthttpClient(p.c)
+		switch {
+		case p.c.handshakeOnly():
+			p.client, err = newHandshakeClient(p.c)
+		case p.c.Grpc:
+			p.client, err = newGrpcClient(p.c)
+		case p.c.Http3:
+			p.client, err = newHttp3Client(p.c)
+		case p.c.Script != "":
+			p.client, err = newScriptClient(p.c)
+		case p.c.Scenario != "":
+			p.client, err = newScenarioClient(p.c)
+		case p.c.streamResponse():
+			p.client, err = newStreamClient(p.c)
+		default:
+			p.client, err = newFasthttpClient(p.c)
+		}
 	}
 
 	return
@@ -121,12 +213,32 @@ func addMissingSchemaAndHost(url string) string {
 	return url
 }
 
+const unixSchema = "unix://"
+
+// splitUnixSocketUrl splits url like unix:///run/app.sock:/path
+// into socket path and http url
+func splitUnixSocketUrl(url string) (socket, httpUrl string, ok bool) {
+	if !strings.HasPrefix(url, unixSchema) {
+		return
+	}
+
+	socket, path := url[len(unixSchema):], "/"
+	if i := strings.Index(socket, ":"); i != -1 {
+		socket, path = socket[:i], socket[i+1:]
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return socket, "http://localhost" + path, true
+}
+
 func (p *Pit) run() tea.Msg {
 	p.startTime = time.Now()
 	n := p.c.Connections
 	p.wg.Add(n)
 	for i := 0; i < n; i++ {
-		go p.worker()
+		go p.worker(i)
 	}
 	// wait for all workers stop
 	p.wg.Wait()
@@ -134,7 +246,13 @@ func (p *Pit) run() tea.Msg {
 	return done
 }
 
-func (p *Pit) worker() {
+func (p *Pit) worker(id int) {
+	do := p.do
+	if vc, ok := p.client.(vuClient); ok {
+		// the worker acts as a virtual user
+		do = func() (int, time.Duration, error) { return vc.doVU(id) }
+	}
+
 	for {
 		select {
 		case <-p.doneChan:
@@ -142,7 +260,7 @@ func (p *Pit) worker() {
 			return
 		default:
 			if p.limiter.allow() {
-				p.statistic(p.do())
+				p.statistic(do())
 			}
 		}
 	}
@@ -170,9 +288,7 @@ func (p *Pit) statistic(code int, latency time.Duration, err error) {
 	// reached count
 	if p.c.Count > 0 && atomic.LoadInt64(&p.reqs) == int64(p.c.Count) {
 		p.appendRps(float64(p.roundReqs) / elapsed.Seconds())
-		p.done = true
-		// notify workers to stop
-		close(p.doneChan)
+		p.finish()
 		return
 	}
 
@@ -188,8 +304,27 @@ func (p *Pit) statistic(code int, latency time.Duration, err error) {
 
 	// exceed duration
 	if p.c.Count <= 0 && atomic.LoadInt64(&p.elapsed) >= int64(p.c.Duration) {
-		p.done = true
-		// notify workers to stop
-		close(p.doneChan)
+		p.finish()
+	}
+}
+
+// stop stops benchmarking
+func (p *Pit) stop() {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if !p.done {
+		p.finish()
+	}
+}
+
+// finish marks done and notifies workers to stop, p.mut must be held
+func (p *Pit) finish() {
+	p.done = true
+	close(p.doneChan)
+
+	if s, ok := p.client.(interface{ stop() }); ok {
+		// workers may wait for clients rather than doneChan
+		s.stop()
 	}
 }
@@ -61,6 +61,41 @@ func Test_Pit_Init(t *testing.T) {
 		assert.NotNil(t, p.init())
 	})
 
+	t.Run("error resolve", func(t *testing.T) {
+		p := New(Config{Url: url, Resolve: []string{"foo"}})
+		assert.NotNil(t, p.init())
+	})
+
+	t.Run("error local address", func(t *testing.T) {
+		p := New(Config{Url: url, LocalAddrs: []string{"foo"}})
+		assert.NotNil(t, p.init())
+	})
+
+	t.Run("unix socket", func(t *testing.T) {
+		p := New(Config{Url: "unix:///run/app.sock:/foo"})
+		assert.Nil(t, p.init())
+		assert.Equal(t, "/run/app.sock", p.c.UnixSocket)
+		assert.Equal(t, "http://localhost/foo", p.c.Url)
+	})
+
+	t.Run("conflicting modes", func(t *testing.T) {
+		for c, expected := range map[*Config]string{
+			{Url: url, Http3: true, Grpc: true}:            "only one of http3, grpc can be specified",
+			{Url: url, Http2: true, Pipeline: true}:        "only one of http2, pipeline can be specified",
+			{Url: url, Script: "a.js", Scenario: "a.json"}: "only one of script, scenario can be specified",
+			{Url: url, Http3: true, Script: "a.js"}:        "http3 doesn't work with script",
+			{Url: url, Grpc: true, Scenario: "a.json"}:     "grpc doesn't work with scenario",
+		} {
+			assert.EqualError(t, New(*c).init(), expected)
+		}
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		p := New(Config{Url: url, Grpc: true})
+		assert.Nil(t, p.init())
+		assert.IsType(t, &grpcClient{}, p.client)
+	})
+
 	t.Run("success", func(t *testing.T) {
 		p := New(Config{Url: url})
 		assert.Nil(t, p.init())
@@ -138,6 +173,31 @@ func Test_addMissingSchemaAndHost(t *testing.T) {
 	}
 }
 
+func Test_splitUnixSocketUrl(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		url    string
+		socket string
+		target string
+		ok     bool
+	}{
+		{"unix:///run/app.sock:/foo?a=b", "/run/app.sock", "http://localhost/foo?a=b", true},
+		{"unix:///run/app.sock:foo", "/run/app.sock", "http://localhost/foo", true},
+		{"unix:///run/app.sock", "/run/app.sock", "http://localhost/", true},
+		{"http://example.com", "", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			socket, url, ok := splitUnixSocketUrl(tc.url)
+			assert.Equal(t, tc.socket, socket)
+			assert.Equal(t, tc.target, url)
+			assert.Equal(t, tc.ok, ok)
+		})
+	}
+}
+
 type fakeClient struct {
 	err   error
 	count int64
@@ -0,0 +1,70 @@
+// Package pittest benchmarks handlers in process with testing.B, it's
+// apart from package pit, so that binaries don't link package testing
+package pittest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gonetx/httpit/pit"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// BenchmarkHandler benchmarks a fasthttp handler in process with b.N
+// requests, and reports rps and latency metrics to b. Only requests
+// are timed, starting and shutting down the server are not.
+func BenchmarkHandler(b *testing.B, c pit.Config, h fasthttp.RequestHandler) *pit.Result {
+	b.Helper()
+
+	hs := pit.StartHandler(h)
+	defer func() { _ = hs.Close() }()
+
+	c.Count = b.N
+	b.ResetTimer()
+	r, err := hs.Run(context.Background(), c)
+	b.StopTimer()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportMetric(r.Rps.Avg, "rps")
+	b.ReportMetric(float64(r.Latency.P50)/float64(time.Millisecond), "p50-ms")
+	b.ReportMetric(float64(r.Latency.P99)/float64(time.Millisecond), "p99-ms")
+
+	return r
+}
+
+// BenchmarkHTTPHandler is like BenchmarkHandler but benchmarks a net/http handler
+func BenchmarkHTTPHandler(b *testing.B, c pit.Config, h http.Handler) *pit.Result {
+	b.Helper()
+
+	return BenchmarkHandler(b, c, fasthttpadaptor.NewFastHTTPHandler(h))
+}
+
+// CheckHandler benchmarks a fasthttp handler in process within a plain
+// test, the test fails if the benchmark fails or any threshold is exceeded
+func CheckHandler(t testing.TB, c pit.Config, h fasthttp.RequestHandler, th pit.Thresholds) *pit.Result {
+	t.Helper()
+
+	r, err := pit.RunHandler(context.Background(), c, h)
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+
+	if err = r.Check(th); err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+// CheckHTTPHandler is like CheckHandler but benchmarks a net/http handler
+func CheckHTTPHandler(t testing.TB, c pit.Config, h http.Handler, th pit.Thresholds) *pit.Result {
+	t.Helper()
+
+	return CheckHandler(t, c, fasthttpadaptor.NewFastHTTPHandler(h), th)
+}
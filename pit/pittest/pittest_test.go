@@ -0,0 +1,71 @@
+package pittest
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gonetx/httpit/pit"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_CheckHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("within thresholds", func(t *testing.T) {
+		r := CheckHandler(t, pit.Config{Count: 100, Connections: 4}, func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString("hello")
+		}, pit.Thresholds{MaxErrorRate: 0.01, MaxLatencyP99: time.Second})
+		assert.True(t, r.Code2xx >= 100)
+	})
+
+	t.Run("exceeded", func(t *testing.T) {
+		ft := &fatalRecorder{T: t}
+		r := CheckHandler(ft, pit.Config{Count: 10, Connections: 1}, func(ctx *fasthttp.RequestCtx) {
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		}, pit.Thresholds{MaxNon2xx: 1})
+		assert.NotNil(t, r)
+		assert.Contains(t, ft.msg, "non-2xx responses")
+	})
+}
+
+func Test_CheckHTTPHandler(t *testing.T) {
+	t.Parallel()
+
+	r := CheckHTTPHandler(t, pit.Config{Count: 100, Connections: 4}, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}), pit.Thresholds{MaxErrorRate: 0.01})
+	assert.True(t, r.Code2xx >= 100)
+}
+
+// fatalRecorder records the failure instead of stopping the test
+type fatalRecorder struct {
+	*testing.T
+	msg string
+}
+
+func (r *fatalRecorder) Fatal(args ...interface{}) {
+	r.msg = fmt.Sprint(args...)
+}
+
+func Benchmark_Handler(b *testing.B) {
+	r := BenchmarkHandler(b, pit.Config{Connections: 8}, func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("hello")
+	})
+
+	if err := r.Check(pit.Thresholds{MaxErrorRate: 0.01}); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func Benchmark_HTTPHandler(b *testing.B) {
+	r := BenchmarkHTTPHandler(b, pit.Config{Connections: 8}, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	if err := r.Check(pit.Thresholds{MaxErrorRate: 0.01}); err != nil {
+		b.Fatal(err)
+	}
+}
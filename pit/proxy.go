@@ -0,0 +1,109 @@
+package pit
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// parseProxy parses a proxy address, the scheme is def if it's missing
+func parseProxy(proxy, def string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = def + "://" + proxy
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host of proxy %q", u.Redacted())
+	}
+
+	return u, nil
+}
+
+// parseProxies collects proxies which connections use in rotation,
+// proxies from environment are only used if none is specified
+func (c *Config) parseProxies() error {
+	var proxies []string
+	if c.HttpProxy != "" {
+		proxies = append(proxies, c.HttpProxy)
+	}
+	if c.SocksProxy != "" {
+		u, err := parseProxy(c.SocksProxy, "socks5")
+		if err != nil {
+			return err
+		}
+		proxies = append(proxies, u.String())
+	}
+	proxies = append(proxies, c.Proxies...)
+
+	if len(proxies) == 0 && c.ProxyFromEnv {
+		target, err := url.Parse(c.Url)
+		if err != nil {
+			return err
+		}
+		// HTTP_PROXY, HTTPS_PROXY and NO_PROXY are respected
+		u, err := httpproxy.FromEnvironment().ProxyFunc()(target)
+		if err != nil {
+			return fmt.Errorf("invalid proxy from environment: %w", err)
+		}
+		if u != nil {
+			proxies = append(proxies, u.String())
+		}
+	}
+
+	if len(proxies) == 0 {
+		return nil
+	}
+
+	for _, proxy := range proxies {
+		if _, err := parseProxy(proxy, "http"); err != nil {
+			return err
+		}
+	}
+	c.proxies = proxies
+	c.proxyStats = c.newGroup("Proxies", "conns")
+
+	return nil
+}
+
+// proxyDialer dials through proxies in rotation per connection,
+// latencies of connecting and dial errors are recorded by proxy
+func (c *Config) proxyDialer() fasthttp.DialFunc {
+	var next uint32
+	names := make([]string, len(c.proxies))
+	dials := make([]fasthttp.DialFunc, len(c.proxies))
+	for i, proxy := range c.proxies {
+		u, _ := parseProxy(proxy, "http")
+		names[i] = u.Scheme + "://" + u.Host
+		if strings.HasPrefix(u.Scheme, "socks5") {
+			dials[i] = fasthttpSocksProxyDialer(&c.throughput, proxy, c.Timeout)
+		} else {
+			dials[i] = fasthttpHttpProxyDialer(&c.throughput, proxy, c.Timeout, c.Insecure)
+		}
+	}
+
+	return func(addr string) (net.Conn, error) {
+		i := int(atomic.AddUint32(&next, 1)-1) % len(dials)
+
+		start := time.Now()
+		conn, err := dials[i](addr)
+		c.proxyStats.add(names[i], time.Since(start), err)
+
+		return conn, err
+	}
+}
@@ -0,0 +1,180 @@
+package pit
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_parseProxy(t *testing.T) {
+	t.Parallel()
+
+	u, err := parseProxy("a:b@127.0.0.1:8080", "http")
+	assert.Nil(t, err)
+	assert.Equal(t, "http", u.Scheme)
+	assert.Equal(t, "127.0.0.1:8080", u.Host)
+	assert.Equal(t, "a", u.User.Username())
+
+	u, err = parseProxy("https://proxy", "http")
+	assert.Nil(t, err)
+	assert.Equal(t, "https", u.Scheme)
+
+	_, err = parseProxy("ftp://proxy", "http")
+	assert.EqualError(t, err, `unsupported proxy scheme "ftp"`)
+
+	_, err = parseProxy("http://", "http")
+	assert.NotNil(t, err)
+}
+
+func Test_Config_parseProxies(t *testing.T) {
+	t.Run("none", func(t *testing.T) {
+		c := &Config{Url: "http://example.com"}
+		assert.Nil(t, c.parseProxies())
+		assert.Nil(t, c.proxies)
+		assert.Nil(t, c.proxyStats)
+	})
+
+	t.Run("all", func(t *testing.T) {
+		c := &Config{
+			Url:        "http://example.com",
+			HttpProxy:  "127.0.0.1:8080",
+			SocksProxy: "127.0.0.1:1080",
+			Proxies:    []string{"https://proxy:8443"},
+		}
+		assert.Nil(t, c.parseProxies())
+		assert.Equal(t, []string{"127.0.0.1:8080", "socks5://127.0.0.1:1080", "https://proxy:8443"}, c.proxies)
+		assert.NotNil(t, c.proxyStats)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		c := &Config{Url: "http://example.com", Proxies: []string{"ftp://proxy"}}
+		assert.NotNil(t, c.parseProxies())
+	})
+
+	t.Run("from env", func(t *testing.T) {
+		setenv(t, "HTTP_PROXY", "http://proxy:8080")
+		setenv(t, "HTTPS_PROXY", "https://proxy:8443")
+		setenv(t, "NO_PROXY", "internal.com")
+
+		for url, proxies := range map[string][]string{
+			"http://example.com":  {"http://proxy:8080"},
+			"https://example.com": {"https://proxy:8443"},
+			"http://internal.com": nil,
+		} {
+			c := &Config{Url: url, ProxyFromEnv: true}
+			assert.Nil(t, c.parseProxies())
+			assert.Equal(t, proxies, c.proxies, url)
+		}
+
+		c := &Config{Url: "http://example.com", ProxyFromEnv: true, Proxies: []string{"http://other:8080"}}
+		assert.Nil(t, c.parseProxies())
+		assert.Equal(t, []string{"http://other:8080"}, c.proxies)
+	})
+}
+
+func setenv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	assert.Nil(t, os.Setenv(key, value))
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, old)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+func Test_Proxies(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() { _ = fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {}) }()
+	t.Cleanup(func() { _ = ln.Close() })
+
+	httpProxy := startConnectProxy(t, nil)
+	httpsProxy := startConnectProxy(t, &tls.Config{Certificates: []tls.Certificate{newTestCert(t)}})
+
+	t.Run("rotation", func(t *testing.T) {
+		r, err := New(Config{
+			Url:               "http://" + ln.Addr().String(),
+			Proxies:           []string{"http://" + httpProxy, "https://" + httpsProxy},
+			Insecure:          true,
+			DisableKeepAlives: true,
+			Connections:       2,
+			Duration:          time.Millisecond * 200,
+		}).RunContext(context.Background())
+		assert.Nil(t, err)
+		assert.Empty(t, r.Errors)
+		assert.True(t, r.Code2xx > 0)
+
+		stats := r.Groups["Proxies"]
+		assert.True(t, stats["http://"+httpProxy].Requests > 0)
+		assert.True(t, stats["https://"+httpsProxy].Requests > 0)
+		assert.Zero(t, stats["https://"+httpsProxy].Errors)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		r, err := New(Config{
+			Url:         "http://" + ln.Addr().String(),
+			Proxies:     []string{"https://" + httpsProxy},
+			Connections: 1,
+			Duration:    time.Millisecond * 100,
+			Timeout:     time.Second,
+		}).RunContext(context.Background())
+		assert.Nil(t, err)
+		assert.NotEmpty(t, r.Errors)
+
+		// the certificate of proxy is not trusted
+		assert.True(t, r.Groups["Proxies"]["https://"+httpsProxy].Errors > 0)
+	})
+}
+
+// startConnectProxy starts an http proxy which only supports CONNECT,
+// connections to it are over tls if conf is not nil
+func startConnectProxy(t *testing.T, conf *tls.Config) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	if conf != nil {
+		ln = tls.NewListener(ln, conf)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				target, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer func() { _ = target.Close() }()
+
+				_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go func() { _, _ = io.Copy(target, conn) }()
+				_, _ = io.Copy(conn, target)
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
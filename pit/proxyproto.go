@@ -0,0 +1,204 @@
+package pit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// keys of PROXY protocol sources
+const proxyProtoRandom = "random"
+
+// proxyProtoV2Sig is the signature of PROXY protocol v2 headers
+var proxyProtoV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProto writes a PROXY protocol header right after a connection is
+// made, before any http or tls bytes, so that the server sees source
+// addresses of clients as if they come through a load balancer
+type proxyProto struct {
+	version int
+	// sources are ips or CIDRs used in rotation, a CIDR gives a random
+	// address in it, random ipv4 addresses are used if it's empty
+	sources []*net.IPNet
+	names   []string
+	next    uint32
+	timeout time.Duration
+	stats   *counter
+}
+
+// parseProxyProtocol parses the PROXY protocol version and its source addresses
+func (c *Config) parseProxyProtocol() error {
+	if c.ProxyProtocol == "" {
+		if len(c.ProxyProtocolSrc) > 0 {
+			return errors.New("PROXY protocol source addresses need a PROXY protocol version")
+		}
+		return nil
+	}
+
+	p := &proxyProto{timeout: c.Timeout}
+	switch strings.ToLower(c.ProxyProtocol) {
+	case "v1", "1":
+		p.version = 1
+	case "v2", "2":
+		p.version = 2
+	default:
+		return fmt.Errorf("invalid PROXY protocol version %q, it should be v1 or v2", c.ProxyProtocol)
+	}
+
+	for _, src := range c.ProxyProtocolSrc {
+		src = strings.TrimSpace(src)
+		if !strings.Contains(src, "/") {
+			ip := net.ParseIP(src)
+			if ip == nil {
+				return fmt.Errorf("invalid PROXY protocol source address %q", src)
+			}
+			bits := 8 * net.IPv6len
+			if v4 := ip.To4(); v4 != nil {
+				ip, bits = v4, 8*net.IPv4len
+			}
+			p.sources = append(p.sources, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			p.names = append(p.names, ip.String())
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(src)
+		if err != nil {
+			return fmt.Errorf("invalid PROXY protocol source address %q", src)
+		}
+		p.sources = append(p.sources, ipNet)
+		p.names = append(p.names, ipNet.String())
+	}
+
+	p.stats = c.newCounter("PROXY protocol sources")
+	c.proxyProto = p
+
+	return nil
+}
+
+// dialer wraps dial to write a PROXY protocol header to new connections
+func (p *proxyProto) dialer(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		src, name := p.source()
+		header := p.header(&net.TCPAddr{IP: src, Port: 1024 + rand.Intn(65536-1024)}, destination(addr, conn))
+
+		if p.timeout > 0 {
+			_ = conn.SetWriteDeadline(time.Now().Add(p.timeout))
+		}
+		if _, err = conn.Write(header); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to write PROXY protocol header: %w", err)
+		}
+		_ = conn.SetWriteDeadline(time.Time{})
+		p.stats.add(name, 1)
+
+		return conn, nil
+	}
+}
+
+// source returns the source ip of a new connection and where it comes from
+func (p *proxyProto) source() (net.IP, string) {
+	if len(p.sources) == 0 {
+		return randomIPv4(), proxyProtoRandom
+	}
+
+	i := int(atomic.AddUint32(&p.next, 1)-1) % len(p.sources)
+	return randomIP(p.sources[i]), p.names[i]
+}
+
+// randomIPv4 returns a random unicast ipv4 address
+func randomIPv4() net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, rand.Uint32())
+	// avoid this network, loopback, multicast and reserved addresses
+	ip[0] = byte(1 + rand.Intn(223))
+	if ip[0] == 127 {
+		ip[0] = 10
+	}
+	return ip
+}
+
+// randomIP returns a random ip of ipNet
+func randomIP(ipNet *net.IPNet) net.IP {
+	ip := make(net.IP, len(ipNet.IP))
+	for i := range ip {
+		ip[i] = ipNet.IP[i]&ipNet.Mask[i] | byte(rand.Intn(256))&^ipNet.Mask[i]
+	}
+	return ip
+}
+
+// destination returns the address the connection is made to, the
+// url host is used if it's an ip, otherwise the remote address of tcp
+// connections. Unspecified ip is used for others like unix sockets.
+func destination(addr string, conn net.Conn) *net.TCPAddr {
+	host, port, _ := net.SplitHostPort(addr)
+	dst := &net.TCPAddr{IP: net.ParseIP(host)}
+	dst.Port, _ = strconv.Atoi(port)
+	if dst.IP == nil {
+		if ta, ok := conn.RemoteAddr().(*net.TCPAddr); ok && ta.IP != nil {
+			dst.IP = ta.IP
+		} else {
+			dst.IP = net.IPv4zero
+		}
+	}
+	return dst
+}
+
+// header returns the PROXY protocol header, both addresses are
+// converted to ipv6 if any of them is ipv6
+func (p *proxyProto) header(src, dst *net.TCPAddr) []byte {
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	if srcIP == nil || dstIP == nil {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+	}
+
+	if p.version == 1 {
+		proto := "TCP4"
+		if len(srcIP) == net.IPv6len {
+			proto = "TCP6"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, ipString(srcIP), ipString(dstIP), src.Port, dst.Port))
+	}
+
+	var buf bytes.Buffer
+	_, _ = buf.Write(proxyProtoV2Sig)
+	// version 2 with PROXY command
+	_ = buf.WriteByte(0x21)
+	// TCP over IPv4 or IPv6
+	if len(srcIP) == net.IPv4len {
+		_ = buf.WriteByte(0x11)
+	} else {
+		_ = buf.WriteByte(0x21)
+	}
+	_ = binary.Write(&buf, binary.BigEndian, uint16(2*len(srcIP)+4))
+	_, _ = buf.Write(srcIP)
+	_, _ = buf.Write(dstIP)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(src.Port))
+	_ = binary.Write(&buf, binary.BigEndian, uint16(dst.Port))
+
+	return buf.Bytes()
+}
+
+// ipString formats ip like String, but ipv4-mapped ipv6 addresses
+// keep the ipv6 form
+func ipString(ip net.IP) string {
+	if len(ip) == net.IPv6len {
+		if v4 := ip.To4(); v4 != nil {
+			return "::ffff:" + v4.String()
+		}
+	}
+	return ip.String()
+}
@@ -0,0 +1,182 @@
+package pit
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_Config_parseProxyProtocol(t *testing.T) {
+	t.Parallel()
+
+	t.Run("none", func(t *testing.T) {
+		c := &Config{}
+		assert.Nil(t, c.parseProxyProtocol())
+		assert.Nil(t, c.proxyProto)
+	})
+
+	t.Run("sources without version", func(t *testing.T) {
+		c := &Config{ProxyProtocolSrc: []string{"10.0.0.1"}}
+		assert.EqualError(t, c.parseProxyProtocol(), "PROXY protocol source addresses need a PROXY protocol version")
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		c := &Config{ProxyProtocol: "v3"}
+		assert.EqualError(t, c.parseProxyProtocol(), `invalid PROXY protocol version "v3", it should be v1 or v2`)
+	})
+
+	t.Run("invalid source", func(t *testing.T) {
+		c := &Config{ProxyProtocol: "v1", ProxyProtocolSrc: []string{"10.0.0"}}
+		assert.EqualError(t, c.parseProxyProtocol(), `invalid PROXY protocol source address "10.0.0"`)
+
+		c = &Config{ProxyProtocol: "v1", ProxyProtocolSrc: []string{"10.0.0.0/33"}}
+		assert.EqualError(t, c.parseProxyProtocol(), `invalid PROXY protocol source address "10.0.0.0/33"`)
+	})
+
+	t.Run("sources", func(t *testing.T) {
+		c := &Config{ProxyProtocol: "V2", ProxyProtocolSrc: []string{"10.0.0.1", " 10.1.0.0/16", "2001:db8::/64"}}
+		assert.Nil(t, c.parseProxyProtocol())
+		assert.Equal(t, 2, c.proxyProto.version)
+		assert.Equal(t, []string{"10.0.0.1", "10.1.0.0/16", "2001:db8::/64"}, c.proxyProto.names)
+
+		for i := 0; i < 6; i++ {
+			ip, name := c.proxyProto.source()
+			switch i % 3 {
+			case 0:
+				assert.Equal(t, "10.0.0.1", ip.String())
+			case 1:
+				assert.True(t, c.proxyProto.sources[1].Contains(ip))
+			case 2:
+				assert.True(t, c.proxyProto.sources[2].Contains(ip))
+			}
+			assert.Equal(t, c.proxyProto.names[i%3], name)
+		}
+	})
+
+	t.Run("random sources", func(t *testing.T) {
+		c := &Config{ProxyProtocol: "v1"}
+		assert.Nil(t, c.parseProxyProtocol())
+
+		ip, name := c.proxyProto.source()
+		assert.Equal(t, proxyProtoRandom, name)
+		assert.NotNil(t, ip.To4())
+		assert.False(t, ip.IsLoopback() || ip.IsMulticast() || ip.IsUnspecified())
+	})
+}
+
+func Test_proxyProto_header(t *testing.T) {
+	t.Parallel()
+
+	v4Src := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 50000}
+	v4Dst := &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 443}
+	v6Src := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 50000}
+
+	t.Run("v1", func(t *testing.T) {
+		p := &proxyProto{version: 1}
+		assert.Equal(t, "PROXY TCP4 10.0.0.1 192.168.0.1 50000 443\r\n", string(p.header(v4Src, v4Dst)))
+		assert.Equal(t, "PROXY TCP6 2001:db8::1 ::ffff:192.168.0.1 50000 443\r\n", string(p.header(v6Src, v4Dst)))
+	})
+
+	t.Run("v2", func(t *testing.T) {
+		p := &proxyProto{version: 2}
+		assert.Equal(t, "0d0a0d0a000d0a515549540a"+"21"+"11"+"000c"+"0a000001"+"c0a80001"+"c350"+"01bb",
+			hex.EncodeToString(p.header(v4Src, v4Dst)))
+		assert.Equal(t, "0d0a0d0a000d0a515549540a"+"21"+"21"+"0024"+
+			"20010db8000000000000000000000001"+"00000000000000000000ffffc0a80001"+"c350"+"01bb",
+			hex.EncodeToString(p.header(v6Src, v4Dst)))
+	})
+}
+
+func Test_ProxyProtocol(t *testing.T) {
+	t.Parallel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var (
+		mut     sync.Mutex
+		headers []string
+	)
+	go func() {
+		_ = fasthttp.Serve(&proxyProtoListener{Listener: ln, header: func(h string) {
+			mut.Lock()
+			headers = append(headers, h)
+			mut.Unlock()
+		}}, func(ctx *fasthttp.RequestCtx) {})
+	}()
+
+	r, err := New(Config{
+		Url:               "http://" + ln.Addr().String(),
+		ProxyProtocol:     "v1",
+		ProxyProtocolSrc:  []string{"10.0.0.1", "10.1.0.0/24"},
+		DisableKeepAlives: true,
+		Connections:       1,
+		Count:             4,
+		Timeout:           time.Second,
+	}).RunContext(context.Background())
+	assert.Nil(t, err)
+	assert.Empty(t, r.Errors)
+	assert.Equal(t, int64(4), r.Code2xx)
+	assert.Equal(t, int64(2), r.Counters["PROXY protocol sources"]["10.0.0.1"])
+	assert.Equal(t, int64(2), r.Counters["PROXY protocol sources"]["10.1.0.0/24"])
+
+	mut.Lock()
+	defer mut.Unlock()
+	assert.Len(t, headers, 4)
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	for i, h := range headers {
+		fields := strings.Fields(h)
+		if assert.Len(t, fields, 6) {
+			assert.Equal(t, "PROXY", fields[0])
+			assert.Equal(t, "TCP4", fields[1])
+			if i%2 == 0 {
+				assert.Equal(t, "10.0.0.1", fields[2])
+			} else {
+				assert.True(t, strings.HasPrefix(fields[2], "10.1.0."))
+			}
+			assert.Equal(t, "127.0.0.1", fields[3])
+			assert.Equal(t, port, fields[5])
+		}
+	}
+}
+
+// proxyProtoListener reads PROXY protocol v1 headers of accepted connections
+type proxyProtoListener struct {
+	net.Listener
+	header func(string)
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	h, err := br.ReadString('\n')
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	l.header(h)
+
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (bc *bufferedConn) Read(b []byte) (int, error) {
+	return bc.r.Read(b)
+}
@@ -0,0 +1,282 @@
+package pit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Result is the result of a benchmark
+type Result struct {
+	// Url is the benchmark target
+	Url string
+	// Connections is the number of concurrent connections
+	Connections int
+	// Requests is the number of succeeded requests
+	Requests int64
+	// Elapsed is the benchmark duration
+	Elapsed time.Duration
+	// Code1xx ~ Code5xx are numbers of responses by status code class
+	Code1xx    int64
+	Code2xx    int64
+	Code3xx    int64
+	Code4xx    int64
+	Code5xx    int64
+	CodeOthers int64
+	// Errors are numbers of failed requests by error message
+	Errors map[string]int
+	// Rps is statistics of requests per second
+	Rps RpsResult
+	// Latency is the latency distribution of succeeded requests
+	Latency LatencyResult
+	// Bytes is the number of read and written bytes
+	Bytes int64
+	// Throughput is read and written bytes per second
+	Throughput float64
+	// Counters are extra counters like gRPC codes by name
+	Counters map[string]map[string]int64
+	// Groups are extra statistics like remote addresses by name
+	Groups map[string]map[string]GroupResult
+	// Metrics are extra numeric values like custom metrics of script by name
+	Metrics map[string]map[string]MetricResult
+	// Compressions are body sizes of requests and responses by name
+	// and content encoding
+	Compressions map[string]map[string]CompressionResult
+}
+
+// RpsResult is statistics of requests per second
+type RpsResult struct {
+	Avg   float64
+	Stdev float64
+	Max   float64
+}
+
+// LatencyResult is a latency distribution
+type LatencyResult struct {
+	Avg   time.Duration
+	Stdev time.Duration
+	Min   time.Duration
+	Max   time.Duration
+	P50   time.Duration
+	P75   time.Duration
+	P90   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	P999  time.Duration
+}
+
+// GroupResult is statistics of a key in a group
+type GroupResult struct {
+	Requests   int64
+	Errors     int64
+	LatencyAvg time.Duration
+	LatencyMax time.Duration
+}
+
+// MetricResult is statistics of numeric values of a key
+type MetricResult struct {
+	Count int64
+	Avg   float64
+	Min   float64
+	Max   float64
+}
+
+// CompressionResult is statistics of bodies of a content encoding
+type CompressionResult struct {
+	Bodies       int64
+	WireBytes    int64
+	DecodedBytes int64
+	// Ratio is DecodedBytes divided by WireBytes, it's 0
+	// if bodies are not decoded
+	Ratio float64
+	// DecodeErrors is the number of bodies which failed to decode,
+	// they are not counted in Bodies
+	DecodeErrors int64
+}
+
+var errDebugRunContext = errors.New("debug mode is not supported by RunContext")
+
+// RunContext starts benchmarking without terminal ui and returns the
+// result when it's over. If ctx is done before that, the benchmark is
+// stopped, and the result so far is returned with ctx.Err().
+func (p *Pit) RunContext(ctx context.Context) (*Result, error) {
+	if p.c.Debug {
+		return nil, errDebugRunContext
+	}
+
+	run, stop := p.run, p.stop
+	if len(p.c.Agents) > 0 {
+		co, err := p.prepareAgents()
+		if err != nil {
+			return nil, err
+		}
+		p.tui.agents = len(co.agents)
+		p.tui.connections *= len(co.agents)
+		run = co.run
+		stop = func() { _ = co.stop() }
+	} else if err := p.init(); err != nil {
+		return nil, err
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		run()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return p.Result(), nil
+	case <-ctx.Done():
+		stop()
+		<-finished
+		return p.Result(), ctx.Err()
+	}
+}
+
+// Result returns the result of the benchmark so far
+func (p *Pit) Result() *Result {
+	t := p.tui
+	r := &Result{
+		Url:          t.url,
+		Connections:  t.connections,
+		Requests:     atomic.LoadInt64(&t.reqs),
+		Elapsed:      time.Duration(atomic.LoadInt64(&t.elapsed)),
+		Code1xx:      atomic.LoadInt64(&t.code1xx),
+		Code2xx:      atomic.LoadInt64(&t.code2xx),
+		Code3xx:      atomic.LoadInt64(&t.code3xx),
+		Code4xx:      atomic.LoadInt64(&t.code4xx),
+		Code5xx:      atomic.LoadInt64(&t.code5xx),
+		CodeOthers:   atomic.LoadInt64(&t.codeOthers),
+		Errors:       make(map[string]int),
+		Bytes:        atomic.LoadInt64(t.throughput),
+		Counters:     make(map[string]map[string]int64),
+		Groups:       make(map[string]map[string]GroupResult),
+		Metrics:      make(map[string]map[string]MetricResult),
+		Compressions: make(map[string]map[string]CompressionResult),
+	}
+
+	if seconds := r.Elapsed.Seconds(); seconds > 0 {
+		r.Throughput = float64(r.Bytes) / seconds
+	}
+
+	t.statsMut.RLock()
+	r.Rps.Avg, r.Rps.Stdev, r.Rps.Max = rpsResult(t.rps)
+	if math.IsNaN(r.Rps.Stdev) {
+		r.Rps.Stdev = 0
+	}
+	latencies := make([]int64, len(t.latencies))
+	copy(latencies, t.latencies)
+	t.statsMut.RUnlock()
+	r.Latency = latencyDistribution(latencies)
+
+	t.mut.Lock()
+	for err, n := range t.errs {
+		r.Errors[err] = n
+	}
+	t.mut.Unlock()
+
+	for _, s := range p.c.sections {
+		r.addSection(s)
+	}
+
+	return r
+}
+
+func (r *Result) addSection(s section) {
+	switch s := s.(type) {
+	case *counter:
+		hits := make(map[string]int64)
+		s.each(func(key string, n int64) { hits[key] += n })
+		if len(hits) > 0 {
+			r.Counters[s.name] = hits
+		}
+	case *group:
+		stats := make(map[string]GroupResult)
+		s.each(func(key string, gs groupStat) {
+			stats[key] = GroupResult{
+				Requests:   gs.reqs,
+				Errors:     gs.errs,
+				LatencyAvg: avgDuration(gs.latencySum, gs.reqs),
+				LatencyMax: gs.latencyMax,
+			}
+		})
+		if len(stats) > 0 {
+			r.Groups[s.name] = stats
+		}
+	case *metrics:
+		stats := make(map[string]MetricResult)
+		s.each(func(key string, ms metricStat) {
+			stats[key] = MetricResult{Count: ms.count, Avg: ms.avg(), Min: ms.min, Max: ms.max}
+		})
+		if len(stats) > 0 {
+			r.Metrics[s.name] = stats
+		}
+	case *compression:
+		stats := make(map[string]CompressionResult)
+		s.each(func(encoding string, cs compressionStat) {
+			stats[encoding] = CompressionResult{
+				Bodies:       cs.count,
+				WireBytes:    cs.wire,
+				DecodedBytes: cs.decoded,
+				Ratio:        cs.ratio(),
+				DecodeErrors: cs.failed,
+			}
+		})
+		if len(stats) > 0 {
+			r.Compressions[s.name] = stats
+		}
+	case *agentSections:
+		s.mut.Lock()
+		list := s.list
+		s.mut.Unlock()
+		for _, sec := range list {
+			r.addSection(sec)
+		}
+	}
+}
+
+// latencyDistribution computes distribution of latencies in microseconds
+func latencyDistribution(latencies []int64) (d LatencyResult) {
+	if len(latencies) == 0 {
+		return
+	}
+
+	avg, stdev, _ := latencyResult(latencies)
+	d.Avg = msToDuration(avg)
+	if !math.IsNaN(stdev) {
+		d.Stdev = msToDuration(stdev)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	d.Min = usToDuration(latencies[0])
+	d.Max = usToDuration(latencies[len(latencies)-1])
+	d.P50 = percentile(latencies, 50)
+	d.P75 = percentile(latencies, 75)
+	d.P90 = percentile(latencies, 90)
+	d.P95 = percentile(latencies, 95)
+	d.P99 = percentile(latencies, 99)
+	d.P999 = percentile(latencies, 99.9)
+
+	return
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []int64, p float64) time.Duration {
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return usToDuration(sorted[i])
+}
+
+func usToDuration(us int64) time.Duration {
+	return time.Duration(us) * time.Microsecond
+}
+
+func msToDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,122 @@
+package pit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Pit_RunContext(t *testing.T) {
+	t.Parallel()
+
+	t.Run("missing url", func(t *testing.T) {
+		_, err := New(Config{}).RunContext(context.Background())
+		assert.NotNil(t, err)
+	})
+
+	t.Run("debug mode", func(t *testing.T) {
+		_, err := New(Config{Url: "url", Debug: true}).RunContext(context.Background())
+		assert.Equal(t, errDebugRunContext, err)
+	})
+
+	t.Run("count", func(t *testing.T) {
+		p := New(Config{Url: startTargetServer(t), Count: 100, Connections: 2})
+
+		r, err := p.RunContext(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, int64(100), r.Requests)
+		assert.Equal(t, int64(100), r.Code2xx)
+		assert.Equal(t, 2, r.Connections)
+		assert.True(t, r.Bytes > 0)
+		assert.True(t, r.Latency.Max >= r.Latency.P50)
+		assert.True(t, r.Latency.P50 >= r.Latency.Min)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		p := New(Config{Url: "url", Duration: time.Hour})
+		p.client = newFakeClient()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		r, err := p.RunContext(ctx)
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.True(t, r.Requests > 0)
+		assert.True(t, p.done)
+	})
+
+	t.Run("agents", func(t *testing.T) {
+		p := New(Config{
+			Url:         startTargetServer(t),
+			Duration:    time.Millisecond * 300,
+			Connections: 1,
+			Agents:      []string{startAgent(t), startAgent(t)},
+			AgentToken:  testAgentToken,
+		})
+
+		r, err := p.RunContext(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 2, r.Connections)
+		assert.True(t, r.Requests > 0)
+	})
+}
+
+func Test_Pit_Result(t *testing.T) {
+	t.Parallel()
+
+	p := New(Config{Url: "url"})
+	p.c.throughput = 2000
+	p.tui.elapsed = int64(time.Second * 2)
+	p.tui.reqs = 3
+	p.tui.code2xx = 2
+	p.tui.code5xx = 1
+	p.tui.rps = []float64{1}
+	p.tui.latencies = []int64{3000, 1000, 2000}
+	p.tui.errs["timeout"] = 2
+
+	cnt := p.c.newCounter("Codes")
+	cnt.add("OK", 1)
+	g := p.c.newGroup("Addresses", "reqs")
+	g.add("127.0.0.1", time.Millisecond, nil)
+	g.add("127.0.0.1", 0, errors.New("error"))
+	m := p.c.newMetrics("Metrics")
+	m.add("size", 1)
+	m.add("size", 3)
+
+	r := p.Result()
+	assert.Equal(t, int64(3), r.Requests)
+	assert.Equal(t, int64(2), r.Code2xx)
+	assert.Equal(t, int64(1), r.Code5xx)
+	assert.Equal(t, float64(1000), r.Throughput)
+	assert.Equal(t, RpsResult{Avg: 1, Max: 1}, r.Rps)
+	assert.Equal(t, time.Millisecond*2, r.Latency.Avg)
+	assert.Equal(t, time.Millisecond, r.Latency.Min)
+	assert.Equal(t, time.Millisecond*3, r.Latency.Max)
+	assert.Equal(t, time.Millisecond*2, r.Latency.P50)
+	assert.Equal(t, time.Millisecond*3, r.Latency.P99)
+	assert.Equal(t, map[string]int{"timeout": 2}, r.Errors)
+	assert.Equal(t, map[string]int64{"OK": 1}, r.Counters["Codes"])
+	assert.Equal(t, GroupResult{
+		Requests:   1,
+		Errors:     1,
+		LatencyAvg: time.Millisecond,
+		LatencyMax: time.Millisecond,
+	}, r.Groups["Addresses"]["127.0.0.1"])
+	assert.Equal(t, MetricResult{Count: 2, Avg: 2, Min: 1, Max: 3}, r.Metrics["Metrics"]["size"])
+
+	// latencies in tui are not reordered
+	assert.Equal(t, []int64{3000, 1000, 2000}, p.tui.latencies)
+}
+
+func Test_percentile(t *testing.T) {
+	t.Parallel()
+
+	sorted := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	assert.Equal(t, time.Microsecond, percentile(sorted, 0))
+	assert.Equal(t, time.Microsecond*5, percentile(sorted, 50))
+	assert.Equal(t, time.Microsecond*9, percentile(sorted, 90))
+	assert.Equal(t, time.Microsecond*10, percentile(sorted, 99.9))
+}
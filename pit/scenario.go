@@ -0,0 +1,471 @@
+package pit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// scenario is ordered steps of user flows, it's read from a JSON file like
+//
+//	{
+//	  "flows": [{
+//	    "name": "checkout",
+//	    "steps": [{
+//	      "name": "login",
+//	      "method": "POST",
+//	      "url": "/login",
+//	      "body": "{\"user\":\"user${vu}\"}",
+//	      "status": 200,
+//	      "extract": [{"var": "token", "json": "data.token"}]
+//	    }, {
+//	      "name": "order",
+//	      "url": "/orders/${id}",
+//	      "headers": ["Authorization: Bearer ${token}"]
+//	    }]
+//	  }]
+//	}
+//
+// "steps" can be used instead of "flows" if there is only one flow.
+type scenario struct {
+	Flows []*flow `json:"flows"`
+	Steps []*step `json:"steps"`
+}
+
+type flow struct {
+	Name  string  `json:"name"`
+	Steps []*step `json:"steps"`
+}
+
+type step struct {
+	Name    string       `json:"name"`
+	Method  string       `json:"method"`
+	Url     string       `json:"url"`
+	Headers []string     `json:"headers"`
+	Body    string       `json:"body"`
+	Status  int          `json:"status"`
+	Extract []*extractor `json:"extract"`
+
+	key string
+	req *fasthttp.Request
+	// dynamic indicates url, headers or body has variables
+	dynamic bool
+}
+
+// extractor stores a value of response into a variable of the virtual user
+// by one of json path like data.items.0.id, regex, header or cookie
+type extractor struct {
+	Var    string `json:"var"`
+	JSON   string `json:"json"`
+	Regex  string `json:"regex"`
+	Header string `json:"header"`
+	Cookie string `json:"cookie"`
+
+	re *regexp.Regexp
+}
+
+// vu is a virtual user which goes through flows in turn
+type vu struct {
+	id        int
+	vars      map[string]string
+	flow      int
+	step      int
+	iteration int
+	latency   time.Duration
+}
+
+// vuClient makes requests as virtual users, every worker
+// acts as a virtual user with its id
+type vuClient interface {
+	doVU(id int) (int, time.Duration, error)
+}
+
+// scenarioClient runs steps of flows, each call of doVU sends
+// the next step of the virtual user
+type scenarioClient struct {
+	*fasthttpClient
+	base  string
+	flows []*flow
+	vus   []*vu
+	steps *group
+	stats *group
+}
+
+func readScenario(fs *fileSystem, file string) (*scenario, error) {
+	data, err := fs.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var sc scenario
+	if err = json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %s: %w", file, err)
+	}
+
+	if len(sc.Flows) == 0 && len(sc.Steps) > 0 {
+		sc.Flows = []*flow{{Steps: sc.Steps}}
+	}
+	if len(sc.Flows) == 0 {
+		return nil, fmt.Errorf("failed to parse scenario %s: no steps", file)
+	}
+
+	return &sc, nil
+}
+
+func newScenarioClient(c *Config) (sc *scenarioClient, err error) {
+	s, err := readScenario(c.fs, c.Scenario)
+	if err != nil {
+		return
+	}
+
+	sc = &scenarioClient{
+		flows: s.Flows,
+		vus:   make([]*vu, c.Connections),
+	}
+	if sc.fasthttpClient, err = newFasthttpClient(c); err != nil {
+		return
+	}
+
+	uri := sc.rawReq.URI()
+	sc.base = string(uri.Scheme()) + "://" + string(uri.Host())
+
+	for i := range sc.vus {
+		sc.vus[i] = newVU(i)
+	}
+
+	for i, f := range sc.flows {
+		if f.Name == "" {
+			f.Name = "flow " + strconv.Itoa(i+1)
+		}
+		if len(f.Steps) == 0 {
+			return nil, fmt.Errorf("flow %s has no steps", f.Name)
+		}
+		for j, st := range f.Steps {
+			if err = sc.prepareStep(f, st, j); err != nil {
+				return
+			}
+		}
+	}
+
+	sc.steps = c.newGroup("Steps", "reqs")
+	sc.stats = c.newGroup("Flows", "flows")
+
+	return
+}
+
+// prepareStep builds the request template of a step
+func (c *scenarioClient) prepareStep(f *flow, s *step, i int) (err error) {
+	if s.Method == "" {
+		s.Method = fasthttp.MethodGet
+	}
+	if s.Name == "" {
+		s.Name = "step " + strconv.Itoa(i+1)
+	}
+	s.key = s.Name
+	if len(c.flows) > 1 {
+		s.key = f.Name + "/" + s.Name
+	}
+
+	for _, e := range s.Extract {
+		if e.Var == "" {
+			return fmt.Errorf("step %s: missing var of extractor", s.Name)
+		}
+		if e.Regex != "" {
+			if e.re, err = regexp.Compile(e.Regex); err != nil {
+				return fmt.Errorf("step %s: %w", s.Name, err)
+			}
+		}
+	}
+
+	s.dynamic = hasVars(s.Url) || hasVars(s.Body)
+	for _, h := range s.Headers {
+		s.dynamic = s.dynamic || hasVars(h)
+	}
+
+	s.req = fasthttp.AcquireRequest()
+	c.rawReq.CopyTo(s.req)
+	s.req.Header.SetMethod(s.Method)
+	if !s.dynamic {
+		if err = c.setStep(s.req, s.Url, s.Headers, s.Body); err != nil {
+			return fmt.Errorf("step %s: %w", s.Name, err)
+		}
+	}
+
+	return
+}
+
+// setStep sets url, headers and body of a step into req, requests are
+// sent by the client of the target, so that an absolute url must be on
+// the target as well
+func (c *scenarioClient) setStep(req *fasthttp.Request, url string, hs []string, body string) error {
+	if !strings.Contains(url, "://") {
+		url = c.base + url
+	}
+	req.SetRequestURI(url)
+	uri := req.URI()
+	if base := string(uri.Scheme()) + "://" + string(uri.Host()); base != c.base {
+		return fmt.Errorf("url %s is not on target %s", url, c.base)
+	}
+	req.SetBodyString(body)
+
+	return headers(hs).writeToFasthttp(req)
+}
+
+func newVU(id int) *vu {
+	return &vu{id: id, vars: make(map[string]string)}
+}
+
+// reset makes the virtual user starts the next flow
+func (v *vu) reset(flows int) {
+	v.vars = make(map[string]string)
+	v.flow = (v.flow + 1) % flows
+	v.step = 0
+	v.iteration++
+	v.latency = 0
+}
+
+func (c *scenarioClient) do() (int, time.Duration, error) {
+	return c.doVU(0)
+}
+
+func (c *scenarioClient) doVU(id int) (code int, latency time.Duration, err error) {
+	v := c.vus[id%len(c.vus)]
+	f := c.flows[v.flow]
+	s := f.Steps[v.step]
+
+	code, latency, err = c.doStep(v, s, nil)
+	c.steps.add(s.key, latency, err)
+
+	if err == nil {
+		v.latency += latency
+		if v.step++; v.step < len(f.Steps) {
+			return
+		}
+	}
+
+	c.stats.add(f.Name, v.latency, err)
+	v.reset(len(c.flows))
+
+	return
+}
+
+// doStep sends a step of the virtual user and extracts variables from
+// response, the response is written into w if it's not nil
+func (c *scenarioClient) doStep(v *vu, s *step, w func(req *fasthttp.Request, resp *fasthttp.Response)) (code int, latency time.Duration, err error) {
+	req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}()
+
+	s.req.CopyTo(req)
+	if s.dynamic {
+		if err = c.setVUStep(v, s, req); err != nil {
+			return
+		}
+	}
+
+	if c.oauth2 != nil {
+		req.Header.Set(headerAuthorization, c.oauth2.authorization())
+	}
+	if c.signer != nil {
+		if err = c.signer.Sign(req, req.Body()); err != nil {
+			return
+		}
+	}
+
+	if w != nil {
+		latency, err = c.doDebug(req, resp)
+	} else {
+		start := time.Now()
+		err = c.doer.Do(req, resp)
+		latency = time.Since(start)
+	}
+	if err != nil {
+		return
+	}
+
+	code = resp.StatusCode()
+
+	if w != nil {
+		w(req, resp)
+	}
+
+	c.recordResponse(resp)
+
+	if s.Status != 0 && code != s.Status {
+		err = fmt.Errorf("step %s: unexpected status code %d", s.Name, code)
+		return
+	}
+
+	for _, e := range s.Extract {
+		value, ok := e.extract(resp)
+		if !ok {
+			err = fmt.Errorf("step %s: failed to extract %s", s.Name, e.Var)
+			return
+		}
+		v.vars[e.Var] = value
+	}
+
+	return
+}
+
+// setVUStep sets url, headers and body with variables of virtual user into req
+func (c *scenarioClient) setVUStep(v *vu, s *step, req *fasthttp.Request) (err error) {
+	url, err := v.expand(s.Url)
+	if err != nil {
+		return fmt.Errorf("step %s: %w", s.Name, err)
+	}
+
+	body, err := v.expand(s.Body)
+	if err != nil {
+		return fmt.Errorf("step %s: %w", s.Name, err)
+	}
+
+	hs := make([]string, len(s.Headers))
+	for i, h := range s.Headers {
+		if hs[i], err = v.expand(h); err != nil {
+			return fmt.Errorf("step %s: %w", s.Name, err)
+		}
+	}
+
+	if err = c.setStep(req, url, hs, body); err != nil {
+		return fmt.Errorf("step %s: %w", s.Name, err)
+	}
+
+	return
+}
+
+func (c *scenarioClient) doOnce() (err error) {
+	v := newVU(0)
+	for _, s := range c.flows[0].Steps {
+		if _, _, err = c.doStep(v, s, c.writeStep); err != nil {
+			return
+		}
+	}
+
+	return c.wc.Close()
+}
+
+// writeStep writes request and response of a step in debug mode
+func (c *scenarioClient) writeStep(req *fasthttp.Request, resp *fasthttp.Response) {
+	c.writeDebug(req, resp)
+	_, _ = c.wc.Write([]byte("\n\n"))
+}
+
+func hasVars(s string) bool {
+	return strings.Contains(s, "${")
+}
+
+var errUnclosedVar = errors.New("unclosed variable")
+
+// expand replaces ${name} in s with variables of virtual user,
+// ${vu} and ${iteration} are built-in variables
+func (v *vu) expand(s string) (string, error) {
+	if !hasVars(s) {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i == -1 {
+			break
+		}
+		j := strings.IndexByte(s[i:], '}')
+		if j == -1 {
+			return "", errUnclosedVar
+		}
+
+		b.WriteString(s[:i])
+		name := s[i+2 : i+j]
+		switch value, ok := v.vars[name]; {
+		case ok:
+			b.WriteString(value)
+		case name == "vu":
+			b.WriteString(strconv.Itoa(v.id))
+		case name == "iteration":
+			b.WriteString(strconv.Itoa(v.iteration))
+		default:
+			return "", fmt.Errorf("undefined variable %s", name)
+		}
+		s = s[i+j+1:]
+	}
+	b.WriteString(s)
+
+	return b.String(), nil
+}
+
+func (e *extractor) extract(resp *fasthttp.Response) (string, bool) {
+	switch {
+	case e.JSON != "":
+		return extractJSON(resp.Body(), e.JSON)
+	case e.re != nil:
+		m := e.re.FindSubmatch(resp.Body())
+		if m == nil {
+			return "", false
+		}
+		// the first group or the whole match
+		return string(m[len(m)-1]), true
+	case e.Header != "":
+		value := resp.Header.Peek(e.Header)
+		return string(value), value != nil
+	case e.Cookie != "":
+		cookie := fasthttp.AcquireCookie()
+		defer fasthttp.ReleaseCookie(cookie)
+		cookie.SetKey(e.Cookie)
+		if !resp.Header.Cookie(cookie) {
+			return "", false
+		}
+		return string(cookie.Value()), true
+	}
+
+	return "", false
+}
+
+// extractJSON gets value of path like data.items.0.id from a JSON body,
+// strings are not quoted and other values are in JSON
+func extractJSON(body []byte, path string) (string, bool) {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+
+	var value interface{}
+	if err := d.Decode(&value); err != nil {
+		return "", false
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[key]; !ok {
+				return "", false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", false
+			}
+			value = v[i]
+		default:
+			return "", false
+		}
+	}
+
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
@@ -0,0 +1,201 @@
+package pit
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+const testScenario = `{
+  "flows": [{
+    "name": "order",
+    "steps": [{
+      "name": "login",
+      "method": "POST",
+      "url": "/login",
+      "body": "user${vu}",
+      "status": 200,
+      "extract": [
+        {"var": "token", "json": "data.token"},
+        {"var": "id", "regex": "id=(\\d+)"},
+        {"var": "session", "cookie": "session"},
+        {"var": "next", "header": "X-Next"}
+      ]
+    }, {
+      "name": "detail",
+      "url": "${next}/${id}",
+      "headers": ["Authorization: Bearer ${token}", "Cookie: session=${session}"],
+      "status": 200
+    }]
+  }, {
+    "name": "home",
+    "steps": [{"url": "/", "status": 200}]
+  }]
+}`
+
+func Test_ScenarioClient(t *testing.T) {
+	t.Parallel()
+
+	t.Run("flows", func(t *testing.T) {
+		r, err := runScenario(Config{Scenario: writeScenario(t, testScenario), Count: 60, Connections: 2})
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(60), r.Code2xx)
+		assert.Empty(t, r.Errors)
+
+		steps := r.Groups["Steps"]
+		assert.Len(t, steps, 3)
+		assert.True(t, steps["order/login"].Requests > 0)
+		assert.True(t, steps["order/detail"].Requests > 0)
+		assert.True(t, steps["home/step 1"].Requests > 0)
+		assert.True(t, r.Groups["Flows"]["order"].Requests > 0)
+		assert.True(t, r.Groups["Flows"]["home"].Requests > 0)
+	})
+
+	t.Run("failed step", func(t *testing.T) {
+		r, err := runScenario(Config{Scenario: writeScenario(t, `{"steps": [
+			{"name": "missing", "url": "/missing", "status": 200},
+			{"name": "never", "url": "/"}
+		]}`), Duration: time.Millisecond * 100, Connections: 1})
+
+		assert.Nil(t, err)
+		assert.True(t, r.Errors["step missing: unexpected status code 404"] > 0)
+		assert.True(t, r.Groups["Steps"]["missing"].Errors > 0)
+		assert.Equal(t, r.Groups["Steps"]["missing"].Errors, r.Groups["Flows"]["flow 1"].Errors)
+		assert.NotContains(t, r.Groups["Steps"], "never")
+	})
+
+	t.Run("invalid scenario", func(t *testing.T) {
+		for _, content := range []string{`{}`, `{"flows": [{"steps": []}]}`, `{"steps": [{"extract": [{}]}]}`,
+			`{"steps": [{"extract": [{"var": "v", "regex": "("}]}]}`, `[`} {
+			_, err := newScenarioClient(&Config{Url: "http://127.0.0.1", Scenario: writeScenario(t, content)})
+			assert.NotNil(t, err, content)
+		}
+
+		_, err := newScenarioClient(&Config{Url: "http://127.0.0.1", Scenario: "not-exist.json"})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("absolute url", func(t *testing.T) {
+		_, err := newScenarioClient(&Config{Url: "http://127.0.0.1", Scenario: writeScenario(t,
+			`{"steps": [{"url": "http://127.0.0.1/a"}, {"url": "HTTP://127.0.0.1/b"}]}`)})
+		assert.Nil(t, err)
+
+		_, err = newScenarioClient(&Config{Url: "http://127.0.0.1", Scenario: writeScenario(t,
+			`{"steps": [{"name": "other", "url": "http://example.com/a"}]}`)})
+		assert.EqualError(t, err, "step other: url http://example.com/a is not on target http://127.0.0.1")
+
+		_, err = newScenarioClient(&Config{Url: "http://127.0.0.1", Scenario: writeScenario(t,
+			`{"steps": [{"url": "https://127.0.0.1/a"}]}`)})
+		assert.NotNil(t, err)
+
+		sc, err := newScenarioClient(&Config{Url: "http://127.0.0.1", Scenario: writeScenario(t,
+			`{"steps": [{"name": "vu", "url": "http://host${vu}/a"}]}`)})
+		assert.Nil(t, err)
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		assert.EqualError(t, sc.setVUStep(newVU(1), sc.flows[0].Steps[0], req),
+			"step vu: url http://host1/a is not on target http://127.0.0.1")
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		p := New(Config{Url: "http://localhost", Scenario: writeScenario(t, testScenario), Debug: true})
+		p.c.inmemory = startServer(t, scenarioHandler)
+		assert.Nil(t, p.init())
+
+		var buf bytes.Buffer
+		p.client.(*scenarioClient).wc = defaultWriteCloser{Writer: &buf}
+		assert.Nil(t, p.doOnce())
+		assert.Contains(t, buf.String(), "POST /login HTTP/1.1")
+		assert.Contains(t, buf.String(), "GET /orders/42 HTTP/1.1")
+	})
+}
+
+func Test_vu_Expand(t *testing.T) {
+	t.Parallel()
+
+	v := newVU(3)
+	v.iteration = 2
+	v.vars["id"] = "42"
+
+	s, err := v.expand("/users/${id}?vu=${vu}&i=${iteration}")
+	assert.Nil(t, err)
+	assert.Equal(t, "/users/42?vu=3&i=2", s)
+
+	_, err = v.expand("${missing}")
+	assert.Equal(t, "undefined variable missing", err.Error())
+
+	_, err = v.expand("${id")
+	assert.Equal(t, errUnclosedVar, err)
+}
+
+func Test_extractJSON(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"data": {"items": [{"id": 12345678901, "name": "foo", "tags": ["a"]}]}}`)
+	cases := map[string]string{
+		"data.items.0.id":   "12345678901",
+		"data.items.0.name": "foo",
+		"data.items.0.tags": `["a"]`,
+	}
+	for path, expected := range cases {
+		value, ok := extractJSON(body, path)
+		assert.True(t, ok)
+		assert.Equal(t, expected, value)
+	}
+
+	for _, path := range []string{"data.missing", "data.items.1", "data.items.x", "data.items.0.name.x"} {
+		_, ok := extractJSON(body, path)
+		assert.False(t, ok, path)
+	}
+
+	_, ok := extractJSON([]byte("invalid"), "data")
+	assert.False(t, ok)
+}
+
+func runScenario(c Config) (*Result, error) {
+	return RunHandler(context.Background(), c, scenarioHandler)
+}
+
+func scenarioHandler(ctx *fasthttp.RequestCtx) {
+	switch string(ctx.Path()) {
+	case "/":
+	case "/login":
+		if !bytes.HasPrefix(ctx.PostBody(), []byte("user")) {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			return
+		}
+		ctx.Response.Header.Set("X-Next", "/orders")
+		ctx.Response.Header.Set("Set-Cookie", "session=abc; Path=/")
+		ctx.SetBodyString(`{"data": {"token": "t0k3n"}, "link": "/orders?id=42"}`)
+	case "/orders/42":
+		if string(ctx.Request.Header.Peek(headerAuthorization)) != "Bearer t0k3n" ||
+			string(ctx.Request.Header.Cookie("session")) != "abc" {
+			ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+		}
+	default:
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+	}
+}
+
+func startServer(t *testing.T, h fasthttp.RequestHandler) *fasthttputil.InmemoryListener {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{Handler: h}
+	go func() { _ = s.Serve(ln) }()
+	t.Cleanup(func() { _ = s.Shutdown() })
+
+	return ln
+}
+
+func writeScenario(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "scenario.json")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(content), 0600))
+	return file
+}
@@ -0,0 +1,324 @@
+package pit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/valyala/fasthttp"
+)
+
+// scriptClient generates requests and checks responses by a JavaScript
+// file with hooks like
+//
+//	// called once before benchmarking, the result is vu.data
+//	function setup() { return {token: "t0k3n"} }
+//
+//	// returns a url or {method, url, headers, body}
+//	function request(vu) {
+//	  return {url: "/users/" + vu.id, headers: {"Authorization": "Bearer " + vu.data.token}}
+//	}
+//
+//	// res is {status, headers, body, latency}, returns true, false, an error
+//	// message or {ok, error, metrics} where metrics are custom numeric values
+//	function response(vu, res) { return res.status === 200 }
+//
+// every worker acts as a virtual user with its own JavaScript runtime,
+// vu.id and vu.iteration are set before every request, and other fields
+// of vu are kept between requests
+type scriptClient struct {
+	*fasthttpClient
+	base    string
+	vus     []*scriptVU
+	metrics *metrics
+}
+
+type scriptVU struct {
+	iteration int
+	rt        *goja.Runtime
+	obj       *goja.Object
+	request   goja.Callable
+	response  goja.Callable
+}
+
+var (
+	errMissingRequestHook = errors.New("script must define function request(vu)")
+	errScenarioAndScript  = errors.New("only one of scenario and script can be specified")
+)
+
+func newScriptClient(c *Config) (sc *scriptClient, err error) {
+	if c.Scenario != "" {
+		return nil, errScenarioAndScript
+	}
+
+	src, err := c.fs.readFile(c.Script)
+	if err != nil {
+		return
+	}
+
+	prog, err := goja.Compile(c.Script, string(src), false)
+	if err != nil {
+		return
+	}
+
+	data, err := runScriptSetup(prog)
+	if err != nil {
+		return
+	}
+
+	sc = &scriptClient{vus: make([]*scriptVU, c.Connections)}
+	if sc.fasthttpClient, err = newFasthttpClient(c); err != nil {
+		return
+	}
+
+	uri := sc.rawReq.URI()
+	sc.base = string(uri.Scheme()) + "://" + string(uri.Host())
+
+	for i := range sc.vus {
+		if sc.vus[i], err = newScriptVU(prog, i, data); err != nil {
+			return
+		}
+	}
+
+	sc.metrics = c.newMetrics("Script metrics")
+
+	return
+}
+
+// runScriptSetup calls setup() if it's defined and returns its result in
+// JSON, every virtual user parses its own copy, so that they never share
+// objects across goroutines
+func runScriptSetup(prog *goja.Program) ([]byte, error) {
+	rt := goja.New()
+	if _, err := rt.RunProgram(prog); err != nil {
+		return nil, err
+	}
+
+	setup, ok := goja.AssertFunction(rt.Get("setup"))
+	if !ok {
+		return nil, nil
+	}
+
+	v, err := setup(goja.Undefined())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(v.Export())
+	if err != nil {
+		return nil, fmt.Errorf("setup() must return JSON data: %w", err)
+	}
+
+	return data, nil
+}
+
+func newScriptVU(prog *goja.Program, id int, data []byte) (v *scriptVU, err error) {
+	v = &scriptVU{rt: goja.New()}
+	if _, err = v.rt.RunProgram(prog); err != nil {
+		return
+	}
+
+	var ok bool
+	if v.request, ok = goja.AssertFunction(v.rt.Get("request")); !ok {
+		return nil, errMissingRequestHook
+	}
+	v.response, _ = goja.AssertFunction(v.rt.Get("response"))
+
+	v.obj = v.rt.NewObject()
+	_ = v.obj.Set("id", id)
+	_ = v.obj.Set("data", nil)
+	if data != nil {
+		parse, _ := goja.AssertFunction(v.rt.Get("JSON").ToObject(v.rt).Get("parse"))
+		var d goja.Value
+		if d, err = parse(goja.Undefined(), v.rt.ToValue(string(data))); err != nil {
+			return
+		}
+		_ = v.obj.Set("data", d)
+	}
+
+	return
+}
+
+func (c *scriptClient) do() (int, time.Duration, error) {
+	return c.doVU(0)
+}
+
+func (c *scriptClient) doVU(id int) (int, time.Duration, error) {
+	return c.send(c.vus[id%len(c.vus)], false)
+}
+
+// send sends a request generated by the virtual user and checks the response,
+// in debug mode, request and response are written out
+func (c *scriptClient) send(v *scriptVU, debug bool) (code int, latency time.Duration, err error) {
+	req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+	defer func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}()
+
+	c.rawReq.CopyTo(req)
+	_ = v.obj.Set("iteration", v.iteration)
+	v.iteration++
+	if err = c.setRequest(v, req); err != nil {
+		return
+	}
+
+	if c.oauth2 != nil {
+		req.Header.Set(headerAuthorization, c.oauth2.authorization())
+	}
+	if c.signer != nil {
+		if err = c.signer.Sign(req, req.Body()); err != nil {
+			return
+		}
+	}
+
+	if debug {
+		latency, err = c.doDebug(req, resp)
+	} else {
+		start := time.Now()
+		err = c.doer.Do(req, resp)
+		latency = time.Since(start)
+	}
+	if err != nil {
+		return
+	}
+
+	code = resp.StatusCode()
+
+	if debug {
+		c.writeDebug(req, resp)
+	}
+
+	c.recordResponse(resp)
+
+	err = c.check(v, resp, latency)
+
+	return
+}
+
+// setRequest calls request(vu) and sets the result into req
+func (c *scriptClient) setRequest(v *scriptVU, req *fasthttp.Request) error {
+	value, err := v.request(goja.Undefined(), v.obj)
+	if err != nil {
+		return scriptError(err)
+	}
+
+	var url string
+	switch r := value.Export().(type) {
+	case string:
+		url = r
+	case map[string]interface{}:
+		url, _ = r["url"].(string)
+		if method, ok := r["method"].(string); ok && method != "" {
+			req.Header.SetMethod(method)
+		}
+		if hs, ok := r["headers"].(map[string]interface{}); ok {
+			for k, v := range hs {
+				req.Header.Set(k, fmt.Sprint(v))
+			}
+		}
+		switch body := r["body"].(type) {
+		case nil:
+		case string:
+			req.SetBodyString(body)
+		default:
+			b, err := json.Marshal(body)
+			if err != nil {
+				return scriptError(err)
+			}
+			req.SetBody(b)
+			if len(req.Header.ContentType()) == 0 {
+				req.Header.SetContentType(MIMEApplicationJSON)
+			}
+		}
+	default:
+		return errors.New("script: request(vu) must return a url or an object")
+	}
+
+	if url != "" {
+		if !strings.Contains(url, "://") {
+			url = c.base + url
+		}
+		req.SetRequestURI(url)
+	}
+
+	return nil
+}
+
+// check calls response(vu, res) if it's defined, and records custom metrics
+func (c *scriptClient) check(v *scriptVU, resp *fasthttp.Response, latency time.Duration) error {
+	if v.response == nil {
+		return nil
+	}
+
+	res := v.rt.NewObject()
+	_ = res.Set("status", resp.StatusCode())
+	_ = res.Set("body", string(resp.Body()))
+	_ = res.Set("latency", float64(latency)/float64(time.Millisecond))
+	headers := v.rt.NewObject()
+	resp.Header.VisitAll(func(k, v []byte) {
+		_ = headers.Set(string(k), string(v))
+	})
+	_ = res.Set("headers", headers)
+
+	value, err := v.response(goja.Undefined(), v.obj, res)
+	if err != nil {
+		return scriptError(err)
+	}
+
+	switch r := value.Export().(type) {
+	case nil:
+	case bool:
+		if !r {
+			return errScriptCheckFailed
+		}
+	case string:
+		return errors.New("script: " + r)
+	case map[string]interface{}:
+		if ms, ok := r["metrics"].(map[string]interface{}); ok {
+			for name, value := range ms {
+				if f, ok := toFloat(value); ok {
+					c.metrics.add(name, f)
+				}
+			}
+		}
+		if msg, ok := r["error"].(string); ok && msg != "" {
+			return errors.New("script: " + msg)
+		}
+		if ok, exists := r["ok"].(bool); exists && !ok {
+			return errScriptCheckFailed
+		}
+	}
+
+	return nil
+}
+
+var errScriptCheckFailed = errors.New("script: response check failed")
+
+func scriptError(err error) error {
+	if e, ok := err.(*goja.Exception); ok {
+		return errors.New("script: " + e.Value().String())
+	}
+	return fmt.Errorf("script: %w", err)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func (c *scriptClient) doOnce() (err error) {
+	if _, _, err = c.send(c.vus[0], true); err != nil {
+		return
+	}
+
+	return c.wc.Close()
+}
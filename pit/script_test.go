@@ -0,0 +1,139 @@
+package pit
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+const testScript = `
+function setup() {
+  return {token: "t0k3n"};
+}
+
+function request(vu) {
+  if (vu.iteration % 2 === 0) {
+    return {
+      method: "POST",
+      url: "/items?vu=" + vu.id,
+      headers: {"Authorization": "Bearer " + vu.data.token},
+      body: {iteration: vu.iteration}
+    };
+  }
+  return "/";
+}
+
+function response(vu, res) {
+  if (res.status !== 200) {
+    return "unexpected status " + res.status;
+  }
+  return {ok: true, metrics: {size: res.body.length}};
+}
+`
+
+func Test_ScriptClient(t *testing.T) {
+	t.Parallel()
+
+	t.Run("hooks", func(t *testing.T) {
+		r, err := runScript(Config{Script: writeScript(t, testScript), Count: 40, Connections: 2})
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(40), r.Code2xx)
+		assert.Empty(t, r.Errors)
+
+		size := r.Metrics["Script metrics"]["size"]
+		assert.True(t, size.Count > 0)
+		assert.Equal(t, float64(0), size.Min)
+		assert.Equal(t, float64(2), size.Max)
+	})
+
+	t.Run("data of every vu", func(t *testing.T) {
+		r, err := runScript(Config{Script: writeScript(t, `
+function setup() { return {seen: {}, n: 0} }
+function request(vu) {
+  vu.data.n++;
+  vu.data.seen["k" + vu.iteration] = vu.id;
+  return "/?n=" + vu.data.n;
+}
+`), Count: 200, Connections: 4})
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(200), r.Code2xx)
+		assert.Empty(t, r.Errors)
+	})
+
+	t.Run("failed check", func(t *testing.T) {
+		r, err := runScript(Config{Script: writeScript(t, `
+function request(vu) { return "/missing" }
+function response(vu, res) { return res.status === 200 }
+`), Duration: time.Millisecond * 100, Connections: 1})
+
+		assert.Nil(t, err)
+		assert.True(t, r.Errors[errScriptCheckFailed.Error()] > 0)
+	})
+
+	t.Run("exception", func(t *testing.T) {
+		r, err := runScript(Config{Script: writeScript(t, `
+function request(vu) { throw new Error("boom") }
+`), Duration: time.Millisecond * 100, Connections: 1})
+
+		assert.Nil(t, err)
+		assert.True(t, r.Errors["script: Error: boom"] > 0)
+	})
+
+	t.Run("invalid script", func(t *testing.T) {
+		for _, content := range []string{`function (`, `function setup() { throw 1 }`, `var a = 1`} {
+			_, err := newScriptClient(&Config{Url: "http://127.0.0.1", Script: writeScript(t, content), Connections: 1})
+			assert.NotNil(t, err, content)
+		}
+
+		_, err := newScriptClient(&Config{Url: "http://127.0.0.1", Script: "not-exist.js"})
+		assert.NotNil(t, err)
+
+		_, err = newScriptClient(&Config{Url: "http://127.0.0.1", Script: "a.js", Scenario: "a.json"})
+		assert.Equal(t, errScenarioAndScript, err)
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		p := New(Config{Url: "http://localhost", Script: writeScript(t, testScript), Debug: true})
+		p.c.inmemory = startServer(t, scriptHandler)
+		assert.Nil(t, p.init())
+
+		var buf bytes.Buffer
+		p.client.(*scriptClient).wc = defaultWriteCloser{Writer: &buf}
+		assert.Nil(t, p.doOnce())
+		assert.Contains(t, buf.String(), "POST /items?vu=0 HTTP/1.1")
+		assert.Contains(t, buf.String(), `"iteration": 0`)
+	})
+}
+
+func runScript(c Config) (*Result, error) {
+	return RunHandler(context.Background(), c, scriptHandler)
+}
+
+func scriptHandler(ctx *fasthttp.RequestCtx) {
+	switch string(ctx.Path()) {
+	case "/":
+	case "/items":
+		if string(ctx.Request.Header.Peek(headerAuthorization)) != "Bearer t0k3n" ||
+			string(ctx.Request.Header.ContentType()) != MIMEApplicationJSON {
+			ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+			return
+		}
+		ctx.SetBodyString("ok")
+	default:
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+	}
+}
+
+func writeScript(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "script.js")
+	assert.Nil(t, ioutil.WriteFile(file, []byte(content), 0600))
+	return file
+}
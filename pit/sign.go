@@ -0,0 +1,291 @@
+package pit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultHmacHeader          = "X-Signature"
+	defaultHmacTimestampHeader = "X-Timestamp"
+)
+
+// Signer signs every request right before it's sent, body is the
+// request body which may not be in req if stream body is used
+type Signer interface {
+	Sign(req *fasthttp.Request, body []byte) error
+}
+
+var (
+	errMultipleSigners     = errors.New("only one of hmac key and aws sigv4 can be specified")
+	errSigV4WithAuth       = errors.New("aws sigv4 can't be used with user, bearer or oauth2 token url")
+	errSignStreamMultipart = errors.New("request signing doesn't work with streamed multipart bodies")
+)
+
+// getSigner returns the signer of Config or a built-in signer specified by flags
+func (c *Config) getSigner() (s Signer, err error) {
+	if c.HmacKey != "" && c.AwsSigV4 != "" {
+		return nil, errMultipleSigners
+	}
+
+	// sigv4 owns the Authorization header
+	if c.AwsSigV4 != "" && (c.User != "" || c.Bearer != "" || c.OAuth2TokenUrl != "") {
+		return nil, errSigV4WithAuth
+	}
+
+	switch {
+	case c.Signer != nil:
+		s = c.Signer
+	case c.HmacKey != "":
+		s = newHmacSigner(c.HmacKey, c.HmacHeader, c.HmacTimestampHeader)
+	case c.AwsSigV4 != "":
+		if s, err = newSigV4Signer(c.AwsSigV4, c.AwsAccessKey, c.AwsSecretKey, c.AwsSessionToken); err != nil {
+			return nil, err
+		}
+	}
+
+	// files of streamed multipart bodies are never read into memory,
+	// so that there is no body to sign
+	if s != nil && c.Stream && c.multipart != nil {
+		return nil, errSignStreamMultipart
+	}
+
+	return
+}
+
+// hmacSigner signs METHOD\nREQUEST_URI\nTIMESTAMP\nBODY with HMAC-SHA256,
+// timestamp is unix seconds and the signature is hex encoded
+type hmacSigner struct {
+	key             []byte
+	header          string
+	timestampHeader string
+	now             func() time.Time
+}
+
+func newHmacSigner(key, header, timestampHeader string) *hmacSigner {
+	if header == "" {
+		header = defaultHmacHeader
+	}
+	if timestampHeader == "" {
+		timestampHeader = defaultHmacTimestampHeader
+	}
+
+	return &hmacSigner{
+		key:             []byte(key),
+		header:          header,
+		timestampHeader: timestampHeader,
+		now:             time.Now,
+	}
+}
+
+func (s *hmacSigner) Sign(req *fasthttp.Request, body []byte) error {
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+
+	mac := hmac.New(sha256.New, s.key)
+	_, _ = mac.Write(req.Header.Method())
+	_, _ = mac.Write([]byte{'\n'})
+	_, _ = mac.Write(req.URI().RequestURI())
+	_, _ = mac.Write([]byte{'\n'})
+	_, _ = mac.Write([]byte(timestamp))
+	_, _ = mac.Write([]byte{'\n'})
+	_, _ = mac.Write(body)
+
+	req.Header.Set(s.timestampHeader, timestamp)
+	req.Header.Set(s.header, hex.EncodeToString(mac.Sum(nil)))
+
+	return nil
+}
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+)
+
+// sigV4Signer signs requests with AWS Signature Version 4
+type sigV4Signer struct {
+	region       string
+	service      string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	now          func() time.Time
+}
+
+// newSigV4Signer creates a SigV4 signer with scope like region:service,
+// credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables if they are not specified
+func newSigV4Signer(scope, accessKey, secretKey, sessionToken string) (*sigV4Signer, error) {
+	parts := strings.Split(scope, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("failed to parse aws sigv4 %s, format is region:service", scope)
+	}
+
+	if accessKey == "" && secretKey == "" {
+		accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if sessionToken == "" {
+			sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, errors.New("missing aws access key or secret key")
+	}
+
+	return &sigV4Signer{
+		region:       parts[0],
+		service:      parts[1],
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		sessionToken: sessionToken,
+		now:          time.Now,
+	}, nil
+}
+
+func (s *sigV4Signer) Sign(req *fasthttp.Request, body []byte) error {
+	t := s.now().UTC()
+	amzDate, date := t.Format(sigV4TimeFormat), t.Format(sigV4DateFormat)
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+	if s.service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	uri := req.URI()
+	host := req.Header.Host()
+	if len(host) == 0 {
+		host = uri.Host()
+	}
+
+	// canonical headers are host, content-type and x-amz-*
+	headers := map[string]string{"host": string(host)}
+	req.Header.VisitAll(func(k, v []byte) {
+		key := strings.ToLower(string(k))
+		if key == "content-type" || strings.HasPrefix(key, "x-amz-") {
+			headers[key] = strings.Join(strings.Fields(string(v)), " ")
+		}
+	})
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	signedHeaders := strings.Join(names, ";")
+
+	var cr strings.Builder
+	cr.Write(req.Header.Method())
+	cr.WriteByte('\n')
+	cr.WriteString(sigV4EscapePath(string(uri.Path()), s.service != "s3"))
+	cr.WriteByte('\n')
+	cr.WriteString(sigV4CanonicalQuery(uri.QueryArgs()))
+	cr.WriteByte('\n')
+	for _, name := range names {
+		cr.WriteString(name)
+		cr.WriteByte(':')
+		cr.WriteString(headers[name])
+		cr.WriteByte('\n')
+	}
+	cr.WriteByte('\n')
+	cr.WriteString(signedHeaders)
+	cr.WriteByte('\n')
+	cr.WriteString(payloadHash)
+
+	scope := date + "/" + s.region + "/" + s.service + "/aws4_request"
+	stringToSign := sigV4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(cr.String()))
+
+	key := hmacSha256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSha256(key, s.region)
+	key = hmacSha256(key, s.service)
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set(headerAuthorization, sigV4Algorithm+" Credential="+s.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+
+	return nil
+}
+
+// sigV4EscapePath escapes every segment of path, non-s3 services
+// require escaping twice
+func sigV4EscapePath(path string, double bool) string {
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segment = sigV4Escape(segment)
+		if double {
+			segment = sigV4Escape(segment)
+		}
+		segments[i] = segment
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func sigV4CanonicalQuery(args *fasthttp.Args) string {
+	var pairs [][2]string
+	args.VisitAll(func(k, v []byte) {
+		pairs = append(pairs, [2]string{sigV4Escape(string(k)), sigV4Escape(string(v))})
+	})
+	// sorted by key and then value
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+
+	list := make([]string, len(pairs))
+	for i, pair := range pairs {
+		list[i] = pair[0] + "=" + pair[1]
+	}
+
+	return strings.Join(list, "&")
+}
+
+// sigV4Escape escapes all characters except unreserved ones of RFC 3986
+func sigV4Escape(s string) string {
+	const hexChars = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '.' || ch == '_' || ch == '~' {
+			b.WriteByte(ch)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hexChars[ch>>4])
+			b.WriteByte(hexChars[ch&15])
+		}
+	}
+
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
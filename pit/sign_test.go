@@ -0,0 +1,166 @@
+package pit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_Config_GetSigner(t *testing.T) {
+	t.Parallel()
+
+	t.Run("none", func(t *testing.T) {
+		s, err := (&Config{}).getSigner()
+		assert.Nil(t, err)
+		assert.Nil(t, s)
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		signer := newHmacSigner("key", "", "")
+		s, err := (&Config{Signer: signer, AwsSigV4: "invalid"}).getSigner()
+		assert.Nil(t, err)
+		assert.Equal(t, signer, s)
+	})
+
+	t.Run("multiple", func(t *testing.T) {
+		_, err := (&Config{HmacKey: "key", AwsSigV4: "us-east-1:s3"}).getSigner()
+		assert.Equal(t, errMultipleSigners, err)
+	})
+
+	t.Run("aws sigv4 with auth", func(t *testing.T) {
+		for _, c := range []*Config{
+			{AwsSigV4: "us-east-1:s3", User: "user:pass"},
+			{AwsSigV4: "us-east-1:s3", Bearer: "token"},
+			{AwsSigV4: "us-east-1:s3", OAuth2TokenUrl: "http://127.0.0.1/token"},
+		} {
+			_, err := c.getSigner()
+			assert.Equal(t, errSigV4WithAuth, err)
+		}
+	})
+
+	t.Run("streamed multipart body", func(t *testing.T) {
+		_, err := (&Config{HmacKey: "key", Stream: true, multipart: &multipartBody{}}).getSigner()
+		assert.Equal(t, errSignStreamMultipart, err)
+
+		s, err := (&Config{HmacKey: "key", multipart: &multipartBody{}}).getSigner()
+		assert.Nil(t, err)
+		assert.NotNil(t, s)
+	})
+
+	t.Run("invalid aws sigv4", func(t *testing.T) {
+		_, err := (&Config{AwsSigV4: "us-east-1"}).getSigner()
+		assert.Equal(t, "failed to parse aws sigv4 us-east-1, format is region:service", err.Error())
+	})
+
+	t.Run("missing aws keys", func(t *testing.T) {
+		_, err := (&Config{AwsSigV4: "us-east-1:s3", AwsAccessKey: "id"}).getSigner()
+		assert.NotNil(t, err)
+	})
+}
+
+func Test_HmacSigner(t *testing.T) {
+	t.Parallel()
+
+	s := newHmacSigner("secret", "", "")
+	s.now = func() time.Time { return time.Unix(1600000000, 0) }
+
+	req := fasthttp.AcquireRequest()
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.SetRequestURI("http://127.0.0.1/foo?a=1")
+
+	assert.Nil(t, s.Sign(req, []byte("body")))
+	assert.Equal(t, "1600000000", string(req.Header.Peek(defaultHmacTimestampHeader)))
+	assert.Equal(t, hmacHex("secret", "POST\n/foo?a=1\n1600000000\nbody"), string(req.Header.Peek(defaultHmacHeader)))
+}
+
+func Test_SigV4Signer(t *testing.T) {
+	t.Parallel()
+
+	// cases from aws signature version 4 test suite
+	cases := []struct {
+		name, method, url, contentType, body, signedHeaders, signature string
+	}{
+		{"get-vanilla", "GET", "http://example.amazonaws.com/", "", "",
+			"host;x-amz-date", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", "GET", "http://example.amazonaws.com/?Param2=value2&Param1=value1", "", "",
+			"host;x-amz-date", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{"post-x-www-form-urlencoded", "POST", "http://example.amazonaws.com/", MIMEApplicationForm, "Param1=value1",
+			"content-type;host;x-amz-date", "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := newSigV4Signer("us-east-1:service", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "")
+			assert.Nil(t, err)
+			s.now = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+
+			req := fasthttp.AcquireRequest()
+			req.Header.SetMethod(tc.method)
+			req.SetRequestURI(tc.url)
+			if tc.contentType != "" {
+				req.Header.SetContentType(tc.contentType)
+			}
+
+			assert.Nil(t, s.Sign(req, []byte(tc.body)))
+			assert.Equal(t, "20150830T123600Z", string(req.Header.Peek("X-Amz-Date")))
+			assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+				"SignedHeaders="+tc.signedHeaders+", Signature="+tc.signature,
+				string(req.Header.Peek(headerAuthorization)))
+		})
+	}
+
+	t.Run("s3 with session token", func(t *testing.T) {
+		s, err := newSigV4Signer("us-east-1:s3", "id", "secret", "token")
+		assert.Nil(t, err)
+
+		req := fasthttp.AcquireRequest()
+		req.SetRequestURI("http://127.0.0.1:9000/bucket/a b")
+
+		assert.Nil(t, s.Sign(req, nil))
+		assert.Equal(t, "token", string(req.Header.Peek("X-Amz-Security-Token")))
+		assert.Equal(t, sha256Hex(nil), string(req.Header.Peek("X-Amz-Content-Sha256")))
+		assert.Contains(t, string(req.Header.Peek(headerAuthorization)),
+			"SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token")
+	})
+}
+
+func Test_sigV4EscapePath(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "/", sigV4EscapePath("", false))
+	assert.Equal(t, "/a%20b/c~", sigV4EscapePath("/a b/c~", false))
+	assert.Equal(t, "/a%2520b", sigV4EscapePath("/a b", true))
+}
+
+func Test_Signing_Every_Request(t *testing.T) {
+	t.Parallel()
+
+	r, err := RunHandler(context.Background(), Config{
+		Url:     "/foo?a=1",
+		Method:  fasthttp.MethodPost,
+		Body:    "hello",
+		HmacKey: "secret",
+		Count:   20,
+	}, func(ctx *fasthttp.RequestCtx) {
+		msg := "POST\n/foo?a=1\n" + string(ctx.Request.Header.Peek(defaultHmacTimestampHeader)) + "\nhello"
+		if string(ctx.Request.Header.Peek(defaultHmacHeader)) != hmacHex("secret", msg) {
+			ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+		}
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20), r.Code2xx)
+}
+
+func hmacHex(key, msg string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,369 @@
+package pit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
+)
+
+const MIMETextEventStream = "text/event-stream"
+
+var (
+	errStreamEndedEarly = errors.New("stream ended early")
+	errStreamStopped    = errors.New("benchmark is stopped")
+)
+
+// streamClient holds every response open and counts events of the
+// response body stream. For text/event-stream, events are separated
+// by blank lines, otherwise every line is an event.
+type streamClient struct {
+	*fasthttpClient
+	events   int
+	duration time.Duration
+	// benchDuration is the duration of benchmark, streams are
+	// cut off at the end of it
+	benchDuration time.Duration
+	once          sync.Once
+	conns         *streamConns
+	stats         *streamStats
+}
+
+func newStreamClient(c *Config) (sc *streamClient, err error) {
+	switch {
+	case c.Pipeline:
+		return nil, errors.New("stream response doesn't work with pipeline")
+	case c.Count > 0 && c.StreamEvents <= 0 && c.StreamDuration <= 0:
+		// nothing ends endless streams like a duration of benchmark
+		return nil, errors.New("stream events or duration is required to stream responses with requests count")
+	}
+
+	sc = &streamClient{
+		events:   c.StreamEvents,
+		duration: c.StreamDuration,
+		conns:    &streamConns{conns: make(map[*streamConn]struct{})},
+		stats:    &streamStats{},
+	}
+	if c.Count <= 0 {
+		sc.benchDuration = c.Duration
+	}
+	c.streamConns = sc.conns
+
+	if sc.fasthttpClient, err = newFasthttpClient(c); err != nil {
+		return
+	}
+
+	// the connection can't be reused if a stream is
+	// stopped before the end of it
+	sc.rawReq.SetConnectionClose()
+	c.addSection(sc.stats)
+
+	return
+}
+
+func (c *streamClient) do() (code int, latency time.Duration, err error) {
+	var (
+		req  = c.acquireReq()
+		resp = fasthttp.AcquireResponse()
+	)
+
+	defer func() {
+		c.reqPool.Put(req)
+		_ = resp.CloseBodyStream()
+		fasthttp.ReleaseResponse(resp)
+	}()
+
+	if c.stream {
+		bodyStream := c.acquireBodyStream()
+		req.SetBodyStream(bodyStream, -1)
+		defer c.bodyStreamPool.Put(bodyStream)
+	}
+
+	if err = c.sign(req); err != nil {
+		return
+	}
+
+	c.once.Do(func() {
+		if c.benchDuration > 0 {
+			c.conns.setUntil(time.Now().Add(c.benchDuration))
+		}
+	})
+
+	start := time.Now()
+	if err = c.doer.Do(req, resp); err != nil {
+		return
+	}
+
+	code = resp.StatusCode()
+
+	r := resp.BodyStream()
+	if r == nil {
+		// small body is not streamed
+		r = bytes.NewReader(resp.Body())
+	}
+
+	s := stream{
+		sse:   bytes.HasPrefix(resp.Header.ContentType(), []byte(MIMETextEventStream)),
+		start: start,
+		last:  start,
+	}
+	if err = s.read(r, c.events, c.duration); err != nil && c.conns.over() {
+		// the stream is cut off by the end of benchmark
+		err = nil
+	}
+	c.stats.record(&s)
+
+	// use time to first event as latency
+	latency = s.first
+
+	return
+}
+
+// stop closes open connections, so that workers waiting
+// for streams return at once
+func (c *streamClient) stop() {
+	c.conns.closeAll()
+}
+
+// streamConns caps read deadlines of connections by the end of benchmark
+// and closes them once the benchmark is stopped, so that endless streams
+// never hold workers
+type streamConns struct {
+	// until is the end of benchmark in unix nanoseconds, zero if unknown
+	until  int64
+	mut    sync.Mutex
+	conns  map[*streamConn]struct{}
+	closed bool
+}
+
+func (sc *streamConns) setUntil(t time.Time) {
+	atomic.StoreInt64(&sc.until, t.UnixNano())
+}
+
+// over reports whether the benchmark is over
+func (sc *streamConns) over() bool {
+	sc.mut.Lock()
+	closed := sc.closed
+	sc.mut.Unlock()
+
+	until := atomic.LoadInt64(&sc.until)
+	return closed || until > 0 && time.Now().UnixNano() >= until
+}
+
+func (sc *streamConns) dialer(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		c := &streamConn{Conn: conn, sc: sc}
+		sc.mut.Lock()
+		defer sc.mut.Unlock()
+		if sc.closed {
+			_ = conn.Close()
+			return nil, errStreamStopped
+		}
+		sc.conns[c] = struct{}{}
+		_ = c.SetReadDeadline(time.Time{})
+
+		return c, nil
+	}
+}
+
+func (sc *streamConns) closeAll() {
+	sc.mut.Lock()
+	defer sc.mut.Unlock()
+
+	sc.closed = true
+	for c := range sc.conns {
+		_ = c.Conn.Close()
+	}
+}
+
+type streamConn struct {
+	net.Conn
+	sc *streamConns
+}
+
+// SetReadDeadline caps t by the end of benchmark
+func (c *streamConn) SetReadDeadline(t time.Time) error {
+	if until := atomic.LoadInt64(&c.sc.until); until > 0 && (t.IsZero() || t.UnixNano() > until) {
+		t = time.Unix(0, until)
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *streamConn) SetDeadline(t time.Time) error {
+	if err := c.Conn.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	return c.SetReadDeadline(t)
+}
+
+func (c *streamConn) Close() error {
+	c.sc.mut.Lock()
+	delete(c.sc.conns, c)
+	c.sc.mut.Unlock()
+
+	return c.Conn.Close()
+}
+
+// stream is the state of a response body stream
+type stream struct {
+	sse    bool
+	start  time.Time
+	last   time.Time
+	end    time.Time
+	prev   byte
+	events int64
+	bytes  int64
+	first  time.Duration
+	gapSum time.Duration
+	gapMax time.Duration
+}
+
+// read reads events until reaching events count or duration, the
+// stream is ended early if it's over before any of them is reached
+func (s *stream) read(r io.Reader, events int, duration time.Duration) error {
+	defer func() { s.end = time.Now() }()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.bytes += int64(n)
+			s.scan(buf[:n], time.Now())
+		}
+
+		if events > 0 && s.events >= int64(events) ||
+			duration > 0 && time.Since(s.start) >= duration {
+			return nil
+		}
+
+		if err == io.EOF {
+			if events > 0 || duration > 0 {
+				return errStreamEndedEarly
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *stream) scan(b []byte, now time.Time) {
+	for _, c := range b {
+		if c == '\r' {
+			continue
+		}
+		if c == '\n' && (s.sse && s.prev == '\n' || !s.sse && s.prev != '\n' && s.prev != 0) {
+			s.event(now)
+		}
+		s.prev = c
+	}
+}
+
+func (s *stream) event(now time.Time) {
+	if s.events == 0 {
+		s.first = now.Sub(s.start)
+	} else {
+		gap := now.Sub(s.last)
+		s.gapSum += gap
+		if gap > s.gapMax {
+			s.gapMax = gap
+		}
+	}
+	s.events++
+	s.last = now
+}
+
+// streamStats collects statistics of all streams
+type streamStats struct {
+	mut      sync.Mutex
+	streams  int64
+	events   int64
+	bytes    int64
+	elapsed  time.Duration
+	firstSum time.Duration
+	firstMax time.Duration
+	firsts   int64
+	gapSum   time.Duration
+	gapMax   time.Duration
+}
+
+func (ss *streamStats) record(s *stream) {
+	ss.mut.Lock()
+	defer ss.mut.Unlock()
+
+	ss.streams++
+	ss.events += s.events
+	ss.bytes += s.bytes
+	ss.elapsed += s.end.Sub(s.start)
+	if s.events > 0 {
+		ss.firsts++
+		ss.firstSum += s.first
+		if s.first > ss.firstMax {
+			ss.firstMax = s.first
+		}
+	}
+	ss.gapSum += s.gapSum
+	if s.gapMax > ss.gapMax {
+		ss.gapMax = s.gapMax
+	}
+}
+
+func (ss *streamStats) write(buf *bytebufferpool.ByteBuffer) {
+	ss.mut.Lock()
+	defer ss.mut.Unlock()
+
+	if ss.streams == 0 {
+		return
+	}
+
+	_, _ = buf.WriteString("Streams:  ")
+	buf.B = fasthttp.AppendUint(buf.B, int(ss.streams))
+	_, _ = buf.WriteString("  Events:  ")
+	buf.B = fasthttp.AppendUint(buf.B, int(ss.events))
+	_, _ = buf.WriteString("  Events/sec:  ")
+	var rate float64
+	if ss.elapsed > 0 {
+		rate = float64(ss.events) / ss.elapsed.Seconds()
+	}
+	buf.B = strconv.AppendFloat(buf.B, rate, 'f', 2, 64)
+	_, _ = buf.WriteString("  Bytes/stream:  ")
+	size, unit := formatSize(float64(ss.bytes) / float64(ss.streams))
+	buf.B = strconv.AppendFloat(buf.B, size, 'f', 2, 64)
+	_ = buf.WriteByte(' ')
+	_, _ = buf.WriteString(unit)
+
+	_, _ = buf.WriteString("\n  First event:  avg ")
+	writeMs(buf, avgDuration(ss.firstSum, ss.firsts))
+	_, _ = buf.WriteString("  max ")
+	writeMs(buf, ss.firstMax)
+	_, _ = buf.WriteString("  Event gap:  avg ")
+	writeMs(buf, avgDuration(ss.gapSum, ss.events-ss.firsts))
+	_, _ = buf.WriteString("  max ")
+	writeMs(buf, ss.gapMax)
+	_ = buf.WriteByte('\n')
+}
+
+func avgDuration(sum time.Duration, n int64) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	return sum / time.Duration(n)
+}
+
+func writeMs(buf *bytebufferpool.ByteBuffer, d time.Duration) {
+	buf.B = strconv.AppendFloat(buf.B, float64(d.Microseconds())/1000, 'f', 2, 64)
+	_, _ = buf.WriteString("ms")
+}
@@ -0,0 +1,217 @@
+package pit
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
+)
+
+func Test_streamClient_New(t *testing.T) {
+	t.Parallel()
+
+	t.Run("pipeline", func(t *testing.T) {
+		_, err := newStreamClient(&Config{Url: "http://host", StreamResponse: true, Pipeline: true})
+		assert.EqualError(t, err, "stream response doesn't work with pipeline")
+	})
+
+	t.Run("error schema", func(t *testing.T) {
+		_, err := newStreamClient(&Config{Url: "ftp://host", StreamResponse: true})
+		assert.NotNil(t, err)
+	})
+
+	t.Run("count without limits", func(t *testing.T) {
+		_, err := newStreamClient(&Config{Url: "http://host", StreamResponse: true, Count: 1})
+		assert.EqualError(t, err, "stream events or duration is required to stream responses with requests count")
+	})
+
+	t.Run("success", func(t *testing.T) {
+		c := &Config{Url: "http://host", StreamResponse: true}
+		sc, err := newStreamClient(c)
+		assert.Nil(t, err)
+		assert.True(t, sc.rawReq.ConnectionClose())
+		assert.Len(t, c.sections, 1)
+	})
+}
+
+func Test_streamClient_Do(t *testing.T) {
+	t.Parallel()
+
+	addr := startStreamServer(t)
+
+	newClient := func(path string, events int, duration time.Duration) *streamClient {
+		sc, err := newStreamClient(&Config{
+			Url:            "http://" + addr + path,
+			Timeout:        time.Millisecond * 200,
+			StreamResponse: true,
+			StreamEvents:   events,
+			StreamDuration: duration,
+		})
+		assert.Nil(t, err)
+		return sc
+	}
+
+	t.Run("reach events", func(t *testing.T) {
+		sc := newClient("/sse?n=5", 3, 0)
+		code, latency, err := sc.do()
+		assert.Nil(t, err)
+		assert.Equal(t, fasthttp.StatusOK, code)
+		assert.True(t, latency > 0)
+		assert.Equal(t, int64(1), sc.stats.streams)
+		assert.Equal(t, int64(3), sc.stats.events)
+	})
+
+	t.Run("reach duration", func(t *testing.T) {
+		sc := newClient("/sse?n=50", 0, time.Millisecond*30)
+		_, _, err := sc.do()
+		assert.Nil(t, err)
+		assert.True(t, sc.stats.events < 50)
+	})
+
+	t.Run("ended early", func(t *testing.T) {
+		sc := newClient("/sse?n=2", 5, 0)
+		_, _, err := sc.do()
+		assert.Equal(t, errStreamEndedEarly, err)
+		assert.Equal(t, int64(2), sc.stats.events)
+	})
+
+	t.Run("until end", func(t *testing.T) {
+		sc := newClient("/lines?n=4", 0, 0)
+		_, _, err := sc.do()
+		assert.Nil(t, err)
+		assert.Equal(t, int64(4), sc.stats.events)
+		assert.Equal(t, int64(4*len("data\n")), sc.stats.bytes)
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		sc := newClient("/idle", 1, 0)
+		_, _, err := sc.do()
+		assert.NotNil(t, err)
+		assert.NotEqual(t, errStreamEndedEarly, err)
+	})
+}
+
+func Test_Pit_StreamResponse(t *testing.T) {
+	t.Parallel()
+
+	addr := startStreamServer(t)
+
+	t.Run("cut off by duration", func(t *testing.T) {
+		start := time.Now()
+		r, err := New(Config{
+			Url:            "http://" + addr + "/sse?n=100000",
+			Connections:    2,
+			Duration:       time.Millisecond * 200,
+			Timeout:        time.Second,
+			StreamResponse: true,
+		}).RunContext(context.Background())
+		assert.Nil(t, err)
+		assert.True(t, time.Since(start) < time.Second)
+		assert.Empty(t, r.Errors)
+		assert.True(t, r.Code2xx > 0)
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+
+		start := time.Now()
+		_, err := New(Config{
+			Url:            "http://" + addr + "/sse?n=100000",
+			Connections:    2,
+			Count:          2,
+			Timeout:        time.Second,
+			StreamResponse: true,
+			StreamDuration: time.Minute,
+		}).RunContext(ctx)
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.True(t, time.Since(start) < time.Second)
+	})
+}
+
+func Test_stream_scan(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	t.Run("sse", func(t *testing.T) {
+		s := &stream{sse: true, start: now, last: now}
+		s.scan([]byte("data: a\r\n\r\ndata: b\n"), now.Add(time.Millisecond))
+		s.scan([]byte("\ndata: c\n"), now.Add(time.Millisecond*3))
+		assert.Equal(t, int64(2), s.events)
+		assert.Equal(t, time.Millisecond, s.first)
+		assert.Equal(t, time.Millisecond*2, s.gapMax)
+	})
+
+	t.Run("lines", func(t *testing.T) {
+		s := &stream{start: now, last: now}
+		s.scan([]byte("\na\n\nb\r\nc"), now)
+		assert.Equal(t, int64(2), s.events)
+	})
+}
+
+func Test_streamStats_write(t *testing.T) {
+	t.Parallel()
+
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	ss := &streamStats{}
+	ss.write(buf)
+	assert.Equal(t, "", buf.String())
+
+	now := time.Now()
+	ss.record(&stream{
+		start:  now,
+		end:    now.Add(time.Second),
+		events: 3,
+		bytes:  2000,
+		first:  time.Millisecond,
+		gapSum: time.Millisecond * 4,
+		gapMax: time.Millisecond * 3,
+	})
+	ss.write(buf)
+	assert.Equal(t, "Streams:  1  Events:  3  Events/sec:  3.00  Bytes/stream:  2.00 KB\n"+
+		"  First event:  avg 1.00ms  max 1.00ms  Event gap:  avg 2.00ms  max 3.00ms\n", buf.String())
+}
+
+func startStreamServer(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	s := &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {
+		n := ctx.QueryArgs().GetUintOrZero("n")
+		switch string(ctx.Path()) {
+		case "/sse":
+			ctx.SetContentType(MIMETextEventStream)
+			ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+				for i := 0; i < n; i++ {
+					_, _ = w.WriteString("data: event\n\n")
+					if err := w.Flush(); err != nil {
+						return
+					}
+					time.Sleep(time.Millisecond * 5)
+				}
+			})
+		case "/lines":
+			ctx.SetContentType("application/x-ndjson")
+			ctx.SetBodyString(strings.Repeat("data\n", n))
+		case "/idle":
+			ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+				_, _ = w.WriteString("data")
+				_ = w.Flush()
+				time.Sleep(time.Second)
+			})
+		}
+	}}
+	go func() { _ = s.Serve(ln) }()
+	t.Cleanup(func() { _ = ln.Close() })
+
+	return ln.Addr().String()
+}
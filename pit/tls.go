@@ -0,0 +1,327 @@
+package pit
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/pkcs12"
+)
+
+var tlsVersionValues = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTlsVersion parses version like 1.2, an empty version is 0
+// which means the default one
+func parseTlsVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersionValues[strings.TrimPrefix(strings.ToLower(version), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("invalid tls version %q, 1.0, 1.1, 1.2 and 1.3 are supported", version)
+	}
+	return v, nil
+}
+
+// parseCiphers parses names of cipher suites like TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+// suites of TLS 1.3 are not configurable
+func parseCiphers(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	suites := make(map[string]*tls.CipherSuite)
+	for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		suites[s.Name] = s
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		s, ok := suites[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		if len(s.SupportedVersions) == 1 && s.SupportedVersions[0] == tls.VersionTLS13 {
+			return nil, fmt.Errorf("cipher suite %s of TLS 1.3 is not configurable", s.Name)
+		}
+		ids = append(ids, s.ID)
+	}
+
+	return ids, nil
+}
+
+// readCertPool reads a PEM bundle of CA certificates
+func readCertPool(fs *fileSystem, path string) (*x509.CertPool, error) {
+	b, err := fs.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return pool, nil
+}
+
+// readClientCert reads a client certificate and its private key, certPath
+// can be a PEM file or a PKCS#12 bundle, keyPath can be empty if the key is
+// in certPath, password decrypts the bundle or an encrypted private key
+func readClientCert(fs *fileSystem, certPath, keyPath, password string) (certs []tls.Certificate, err error) {
+	if certPath == "" && keyPath == "" {
+		return
+	}
+
+	var certPEM, keyPEM []byte
+	if certPEM, err = fs.readFile(certPath); err != nil {
+		return
+	}
+
+	if !bytes.Contains(certPEM, []byte("-----BEGIN")) {
+		if certPEM, keyPEM, err = decodePkcs12(certPEM, password); err != nil {
+			return nil, fmt.Errorf("read PKCS#12 bundle %s: %w", certPath, err)
+		}
+	} else {
+		if keyPath == "" {
+			keyPath = certPath
+		}
+		if keyPEM, err = fs.readFile(keyPath); err != nil {
+			return
+		}
+		if keyPEM, err = decryptKeyPEM(keyPEM, password); err != nil {
+			return nil, fmt.Errorf("read private key %s: %w", keyPath, err)
+		}
+	}
+
+	var cert tls.Certificate
+	if cert, err = tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return
+	}
+
+	certs = append(certs, cert)
+
+	return
+}
+
+// decodePkcs12 converts a PKCS#12 bundle to PEM certificates with the leaf
+// first and a PEM private key
+func decodePkcs12(data []byte, password string) (certPEM, keyPEM []byte, err error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		var nie pkcs12.NotImplementedError
+		if errors.As(err, &nie) {
+			err = fmt.Errorf("%w, try to export it with legacy algorithms like openssl pkcs12 -export -legacy", err)
+		}
+		return
+	}
+
+	var (
+		keyId string
+		certs []*pem.Block
+	)
+	for _, b := range blocks {
+		if b.Type == "CERTIFICATE" {
+			certs = append(certs, b)
+		} else {
+			keyId = b.Headers["localKeyId"]
+			keyPEM = pem.EncodeToMemory(&pem.Block{Type: b.Type, Bytes: b.Bytes})
+		}
+	}
+
+	// the leaf certificate shares the local key id with the key
+	for i, b := range certs {
+		if keyId != "" && b.Headers["localKeyId"] == keyId {
+			certs[0], certs[i] = certs[i], certs[0]
+			break
+		}
+	}
+	for _, b := range certs {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: b.Type, Bytes: b.Bytes})...)
+	}
+
+	return
+}
+
+var errKeyPassword = errors.New("private key is encrypted, use --keyPassword to decrypt it")
+
+// decryptKeyPEM decrypts encrypted private keys in PEM of PKCS#8
+// or legacy Proc-Type headers, other blocks are kept
+func decryptKeyPEM(data []byte, password string) ([]byte, error) {
+	var (
+		out       []byte
+		rest      = data
+		encrypted bool
+	)
+
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			if password == "" {
+				return nil, errKeyPassword
+			}
+			der, err := decryptPkcs8(block.Bytes, []byte(password))
+			if err != nil {
+				return nil, err
+			}
+			block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+			encrypted = true
+		// legacy encryption of PEM is insecure, but it's still in use
+		case x509.IsEncryptedPEMBlock(block):
+			if password == "" {
+				return nil, errKeyPassword
+			}
+			der, err := x509.DecryptPEMBlock(block, []byte(password))
+			if err != nil {
+				return nil, err
+			}
+			block = &pem.Block{Type: block.Type, Bytes: der}
+			encrypted = true
+		}
+
+		out = append(out, pem.EncodeToMemory(block)...)
+	}
+
+	if !encrypted {
+		return data, nil
+	}
+	return out, nil
+}
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHmacWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHmacWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHmacWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHmacWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHmacWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Data      []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	Prf        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+var errPkcs8Password = errors.New("failed to decrypt private key, the password may be incorrect")
+
+// decryptPkcs8 decrypts a PKCS#8 private key encrypted by PBES2
+// with PBKDF2 and AES-CBC or DES-EDE3-CBC
+func decryptPkcs8(der, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported encryption algorithm %s, PBES2 is supported", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s, PBKDF2 is supported", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+
+	var prf func() hash.Hash
+	switch algo := kdf.Prf.Algorithm; {
+	case len(algo) == 0 || algo.Equal(oidHmacWithSHA1):
+		prf = sha1.New
+	case algo.Equal(oidHmacWithSHA224):
+		prf = sha256.New224
+	case algo.Equal(oidHmacWithSHA256):
+		prf = sha256.New
+	case algo.Equal(oidHmacWithSHA384):
+		prf = sha512.New384
+	case algo.Equal(oidHmacWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported pseudorandom function %s", algo)
+	}
+
+	var (
+		keyLen   int
+		newBlock func([]byte) (cipher.Block, error)
+	)
+	switch algo := params.EncryptionScheme.Algorithm; {
+	case algo.Equal(oidAES128CBC):
+		keyLen, newBlock = 16, aes.NewCipher
+	case algo.Equal(oidAES192CBC):
+		keyLen, newBlock = 24, aes.NewCipher
+	case algo.Equal(oidAES256CBC):
+		keyLen, newBlock = 32, aes.NewCipher
+	case algo.Equal(oidDESEDE3CBC):
+		keyLen, newBlock = 24, des.NewTripleDESCipher
+	default:
+		return nil, fmt.Errorf("unsupported cipher %s", algo)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	block, err := newBlock(pbkdf2.Key(password, kdf.Salt, kdf.Iterations, keyLen, prf))
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.Data) == 0 || len(info.Data)%block.BlockSize() != 0 {
+		return nil, errPkcs8Password
+	}
+
+	data := make([]byte, len(info.Data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, info.Data)
+
+	// remove PKCS#7 padding
+	n := int(data[len(data)-1])
+	if n == 0 || n > block.BlockSize() || !bytes.Equal(data[len(data)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, errPkcs8Password
+	}
+
+	return data[:len(data)-n], nil
+}
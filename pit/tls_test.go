@@ -0,0 +1,167 @@
+package pit
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_readClientCert(t *testing.T) {
+	t.Parallel()
+
+	t.Run("pem", func(t *testing.T) {
+		cert, err := readClientCert(nil, "testdata/ssl.pem", "testdata/ssl.key", "")
+		assert.Nil(t, err)
+		assert.Len(t, cert, 1)
+	})
+
+	t.Run("pkcs12", func(t *testing.T) {
+		cert, err := readClientCert(nil, "testdata/ssl.p12", "", "httpit")
+		assert.Nil(t, err)
+		assert.Len(t, cert, 1)
+
+		_, err = readClientCert(nil, "testdata/ssl.p12", "", "wrong")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("encrypted keys", func(t *testing.T) {
+		for _, key := range []string{"testdata/ssl.enc.key", "testdata/ssl.legacy.key"} {
+			cert, err := readClientCert(nil, "testdata/ssl.pem", key, "httpit")
+			assert.Nil(t, err, key)
+			assert.Len(t, cert, 1)
+
+			_, err = readClientCert(nil, "testdata/ssl.pem", key, "")
+			assert.ErrorIs(t, err, errKeyPassword)
+
+			_, err = readClientCert(nil, "testdata/ssl.pem", key, "wrong")
+			assert.NotNil(t, err, key)
+		}
+	})
+
+	t.Run("key in cert file", func(t *testing.T) {
+		certPEM, err := ioutil.ReadFile("testdata/ssl.pem")
+		assert.Nil(t, err)
+		keyPEM, err := ioutil.ReadFile("testdata/ssl.key")
+		assert.Nil(t, err)
+
+		cert, err := readClientCert(nil, writeFile(t, "both.pem", string(certPEM)+"\n"+string(keyPEM)), "", "")
+		assert.Nil(t, err)
+		assert.Len(t, cert, 1)
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		_, err := readClientCert(nil, "testdata/not-exist.pem", "testdata/ssl.key", "")
+		assert.NotNil(t, err)
+		_, err = readClientCert(nil, "testdata/ssl.pem", "testdata/not-exist.key", "")
+		assert.NotNil(t, err)
+	})
+}
+
+func Test_parseTlsVersion(t *testing.T) {
+	t.Parallel()
+
+	v, err := parseTlsVersion("")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(0), v)
+
+	v, err = parseTlsVersion("1.2")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), v)
+
+	v, err = parseTlsVersion("TLS1.3")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), v)
+
+	_, err = parseTlsVersion("2.0")
+	assert.NotNil(t, err)
+}
+
+func Test_parseCiphers(t *testing.T) {
+	t.Parallel()
+
+	ids, err := parseCiphers([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "tls_rsa_with_aes_128_cbc_sha"})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_AES_128_CBC_SHA}, ids)
+
+	_, err = parseCiphers([]string{"TLS_AES_128_GCM_SHA256"})
+	assert.EqualError(t, err, "cipher suite TLS_AES_128_GCM_SHA256 of TLS 1.3 is not configurable")
+
+	_, err = parseCiphers([]string{"unknown"})
+	assert.EqualError(t, err, `unknown cipher suite "unknown"`)
+}
+
+func Test_Config_getTlsConfig(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default", func(t *testing.T) {
+		conf, err := (&Config{Connections: 1}).getTlsConfig()
+		assert.Nil(t, err)
+		assert.Nil(t, conf.ClientSessionCache)
+		assert.Nil(t, conf.RootCAs)
+	})
+
+	t.Run("session resumption", func(t *testing.T) {
+		conf, err := (&Config{Connections: 1, SessionResumption: true}).getTlsConfig()
+		assert.Nil(t, err)
+		assert.NotNil(t, conf.ClientSessionCache)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, c := range []*Config{
+			{CaCert: "testdata/not-exist.pem"},
+			{CaCert: "testdata/ssl.key"},
+			{TlsMin: "1.4"},
+			{TlsMax: "1.4"},
+			{TlsMin: "1.3", TlsMax: "1.2"},
+			{Ciphers: []string{"unknown"}},
+			{Cert: "testdata/ssl.pem", Key: "testdata/ssl.enc.key"},
+			{SessionResumption: true, DisableSessionTickets: true},
+		} {
+			_, err := c.getTlsConfig()
+			assert.NotNil(t, err)
+		}
+	})
+
+	t.Run("handshake", func(t *testing.T) {
+		var hello *tls.ClientHelloInfo
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		ts.TLS = &tls.Config{GetConfigForClient: func(h *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = h
+			return nil, nil
+		}}
+		ts.StartTLS()
+		t.Cleanup(ts.Close)
+
+		caCert := writeFile(t, "ca.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})))
+
+		p := New(Config{
+			Url:                   ts.URL,
+			Debug:                 true,
+			CaCert:                caCert,
+			TlsMax:                "1.2",
+			Ciphers:               []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+			Sni:                   "example.com",
+			Alpn:                  []string{"http/1.1"},
+			DisableSessionTickets: true,
+		})
+		assert.Nil(t, p.init())
+
+		var buf bytes.Buffer
+		p.client.(*fasthttpClient).wc = defaultWriteCloser{Writer: &buf}
+		assert.Nil(t, p.doOnce())
+
+		out := stripANSI(buf.String())
+		assert.Contains(t, out, "Version           TLS 1.2\n")
+		assert.Contains(t, out, "Cipher suite      TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384\n")
+		assert.Contains(t, out, "ALPN protocol     http/1.1\n")
+		assert.Contains(t, out, "Verification      ok (custom roots)\n")
+		assert.Equal(t, "example.com", hello.ServerName)
+		assert.Equal(t, []string{"http/1.1"}, hello.SupportedProtos)
+	})
+}
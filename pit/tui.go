@@ -25,11 +25,19 @@ const (
 	processColor = "#444"
 )
 
+// section is an extra part of statistics
+type section interface {
+	// write writes the section into buffer, nothing
+	// should be written if there is no data
+	write(buf *bytebufferpool.ByteBuffer)
+}
+
 type tui struct {
 	r io.Reader
 	w io.Writer
 
 	throughput *int64
+	sections   *[]section
 	reqs       int64
 	elapsed    int64
 	code1xx    int64
@@ -40,6 +48,7 @@ type tui struct {
 	codeOthers int64
 	latencies  []int64
 	rps        []float64
+	statsMut   sync.RWMutex
 	mut        sync.Mutex
 	errs       map[string]int
 	buf        *bytebufferpool.ByteBuffer
@@ -48,6 +57,7 @@ type tui struct {
 	count       int
 	duration    time.Duration
 	connections int
+	agents      int
 	initCmd     tea.Cmd
 	progressBar *progress.Model
 	quitting    bool
@@ -117,26 +127,30 @@ func (t *tui) View() string {
 func (t *tui) appendCode(code int) {
 	switch code / 100 {
 	case 1:
-		t.code1xx++
+		atomic.AddInt64(&t.code1xx, 1)
 	case 2:
-		t.code2xx++
+		atomic.AddInt64(&t.code2xx, 1)
 	case 3:
-		t.code3xx++
+		atomic.AddInt64(&t.code3xx, 1)
 	case 4:
-		t.code4xx++
+		atomic.AddInt64(&t.code4xx, 1)
 	case 5:
-		t.code5xx++
+		atomic.AddInt64(&t.code5xx, 1)
 	default:
-		t.codeOthers++
+		atomic.AddInt64(&t.codeOthers, 1)
 	}
 }
 
 func (t *tui) appendRps(rps float64) {
+	t.statsMut.Lock()
 	t.rps = append(t.rps, rps)
+	t.statsMut.Unlock()
 }
 
 func (t *tui) appendLatency(latency time.Duration) {
+	t.statsMut.Lock()
 	t.latencies = append(t.latencies, latency.Microseconds())
+	t.statsMut.Unlock()
 }
 
 func (t *tui) appendError(err error) {
@@ -155,6 +169,7 @@ func (t *tui) output() string {
 	t.writeThroughput()
 	t.writeStatistics()
 	t.writeCodes()
+	t.writeSections()
 	t.writeErrors()
 	t.writeHint()
 
@@ -166,7 +181,13 @@ func (t *tui) writeTitle() {
 	_, _ = t.buf.WriteString(t.url)
 	_, _ = t.buf.WriteString(" with ")
 	t.writeInt(t.connections)
-	_, _ = t.buf.WriteString(" connections\n")
+	_, _ = t.buf.WriteString(" connections")
+	if t.agents > 0 {
+		_, _ = t.buf.WriteString(" on ")
+		t.writeInt(t.agents)
+		_, _ = t.buf.WriteString(" agents")
+	}
+	_ = t.buf.WriteByte('\n')
 }
 
 func (t *tui) writeProcessBar() {
@@ -231,7 +252,11 @@ func (t *tui) writeStatistics() {
 	_, _ = t.buf.WriteString(lg.NewStyle().Width(fieldWidth).Align(lg.Center).Render("Max"))
 	_ = t.buf.WriteByte('\n')
 
+	t.statsMut.RLock()
 	rpsAvg, rpsStdev, rpsMax := rpsResult(t.rps)
+	latencyAvg, latencyStdev, latencyMax := latencyResult(t.latencies)
+	t.statsMut.RUnlock()
+
 	_, _ = t.buf.WriteString(lg.NewStyle().Width(12).Align(lg.Center).Render("Reqs/sec  "))
 
 	t.writeRps(rpsAvg)
@@ -239,7 +264,6 @@ func (t *tui) writeStatistics() {
 	t.writeRps(rpsMax)
 	_ = t.buf.WriteByte('\n')
 
-	latencyAvg, latencyStdev, latencyMax := latencyResult(t.latencies)
 	_, _ = t.buf.WriteString(lg.NewStyle().Width(12).Align(lg.Center).Render("Latency  "))
 	t.writeLatency(latencyAvg)
 	t.writeLatency(latencyStdev)
@@ -285,6 +309,16 @@ func (t *tui) writeCodes() {
 	_, _ = t.buf.WriteString("\n")
 }
 
+func (t *tui) writeSections() {
+	if t.sections == nil {
+		return
+	}
+
+	for _, s := range *t.sections {
+		s.write(t.buf)
+	}
+}
+
 func (t *tui) writeErrors() {
 	t.mut.Lock()
 	defer t.mut.Unlock()
@@ -384,15 +418,20 @@ func latencyResult(latencies []int64) (avg float64, stdev float64, max float64)
 }
 
 func formatThroughput(throughput float64) (float64, string) {
+	size, unit := formatSize(throughput)
+	return size, unit + "/s"
+}
+
+func formatSize(size float64) (float64, string) {
 	switch {
-	case throughput < 1e3:
-		return throughput, "B/s"
-	case throughput < 1e6:
-		return throughput / 1e3, "KB/s"
-	case throughput < 1e9:
-		return throughput / 1e6, "MB/s"
+	case size < 1e3:
+		return size, "B"
+	case size < 1e6:
+		return size / 1e3, "KB"
+	case size < 1e9:
+		return size / 1e6, "MB"
 	default:
-		return throughput / 1e9, "GB/s"
+		return size / 1e9, "GB"
 	}
 }
 
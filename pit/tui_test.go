@@ -71,6 +71,19 @@ func Test_tui_writeThroughput(t *testing.T) {
 	assert.Contains(t, tt.buf.String(), "1.00 KB/s")
 }
 
+func Test_tui_writeSections(t *testing.T) {
+	t.Parallel()
+
+	c := &Config{}
+	c.newCounter("Empty")
+	c.newCounter("Codes").add("OK", 2)
+
+	tt := newTui()
+	tt.sections = &c.sections
+	tt.writeSections()
+	assert.Equal(t, "Codes:\n  OK - 2\n", tt.buf.String())
+}
+
 func Test_tui_writeErrors(t *testing.T) {
 	t.Parallel()
 